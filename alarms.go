@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+)
+
+type alarmsCommand struct {
+	History alarmsHistoryCommand `command:"history" description:"Interleave alarm state changes with the log matches"`
+}
+
+type alarmsHistoryCommand struct {
+	Alarms []string `long:"alarm" description:"also include this alarm (repeatable)"`
+}
+
+var alarmsOpts alarmsCommand
+
+// RelatedAlarms returns the alarms named in extra followed by those on
+// metrics produced by the metric filters of the given log groups, each once.
+func (l Logs) RelatedAlarms(ctx context.Context, groups, extra []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range extra {
+		add(name)
+	}
+	for _, group := range groups {
+		var transforms []*cloudwatchlogs.MetricTransformation
+		err := l.client().DescribeMetricFiltersPagesWithContext(ctx, &cloudwatchlogs.DescribeMetricFiltersInput{
+			LogGroupName: aws.String(group),
+		}, func(out *cloudwatchlogs.DescribeMetricFiltersOutput, last bool) bool {
+			for _, f := range out.MetricFilters {
+				transforms = append(transforms, f.MetricTransformations...)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range transforms {
+			out, err := l.metrics().DescribeAlarmsForMetricWithContext(ctx, &cloudwatch.DescribeAlarmsForMetricInput{
+				Namespace:  t.MetricNamespace,
+				MetricName: t.MetricName,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range out.MetricAlarms {
+				add(aws.StringValue(a.AlarmName))
+			}
+		}
+	}
+	return names, nil
+}
+
+// AlarmHistory returns the state changes of each alarm between from and to.
+func (l Logs) AlarmHistory(ctx context.Context, alarms []string, from, to time.Time) ([]*cloudwatch.AlarmHistoryItem, error) {
+	var items []*cloudwatch.AlarmHistoryItem
+	for _, name := range alarms {
+		err := l.metrics().DescribeAlarmHistoryPagesWithContext(ctx, &cloudwatch.DescribeAlarmHistoryInput{
+			AlarmName:       aws.String(name),
+			HistoryItemType: aws.String(cloudwatch.HistoryItemTypeStateUpdate),
+			StartDate:       aws.Time(from),
+			EndDate:         aws.Time(to),
+		}, func(out *cloudwatch.DescribeAlarmHistoryOutput, last bool) bool {
+			items = append(items, out.AlarmHistoryItems...)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// timelineEntry is a single result held back until the whole timeline can be
+// sorted.
+type timelineEntry struct {
+	meta *QueryMeta
+	res  QueryResult
+}
+
+// timeline buffers results from every group so they can be merged with
+// alarm state changes in timestamp order.
+type timeline struct {
+	entries []timelineEntry
+}
+
+func (t *timeline) Write(meta *QueryMeta, res []QueryResult) error {
+	for _, r := range res {
+		t.entries = append(t.entries, timelineEntry{meta, r})
+	}
+	return nil
+}
+
+func (t *timeline) Close() error { return nil }
+
+// addAlarms adds each state change as a result of the pseudo group
+// "alarm:<name>".
+func (t *timeline) addAlarms(items []*cloudwatch.AlarmHistoryItem) {
+	for _, item := range items {
+		name := aws.StringValue(item.AlarmName)
+		t.entries = append(t.entries, timelineEntry{
+			meta: &QueryMeta{Group: "alarm:" + name, Engine: "alarm", Status: cloudwatchlogs.QueryStatusComplete},
+			res: QueryResult{
+				Timestamp: aws.TimeValue(item.Timestamp).UTC().Format(insightsTimeLayout),
+				LogStream: name,
+				Message:   "alarm " + name + ": " + aws.StringValue(item.HistorySummary),
+			},
+		})
+	}
+}
+
+// flush writes the entries to out in timestamp order.
+func (t *timeline) flush(out Formatter) error {
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return t.entries[i].res.Timestamp < t.entries[j].res.Timestamp
+	})
+	for _, e := range t.entries {
+		if err := out.Write(e.meta, []QueryResult{e.res}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runAlarmsHistory(ctx context.Context, l *Logs) (*Summary, error) {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, err
+	}
+	q, err := assembleQuery(l)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := l.PlanTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckScanSize(targets); err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, len(targets))
+	for i, t := range targets {
+		groups[i] = t.Group
+	}
+	alarms, err := l.RelatedAlarms(ctx, groups, alarmsOpts.History.Alarms)
+	if err != nil {
+		return nil, err
+	}
+	items, err := l.AlarmHistory(ctx, alarms, from, to)
+	if err != nil {
+		return nil, err
+	}
+	l.logger.Debug("alarms", zap.Strings("alarms", alarms), zap.Int("transitions", len(items)))
+
+	tl := &timeline{}
+	summary := run(ctx, l, targets, q, tl)
+	tl.addAlarms(items)
+
+	out, err := newOutput()
+	if err != nil {
+		return summary, err
+	}
+	if err := tl.flush(out); err != nil {
+		l.logger.Error("output", zap.Error(err))
+	}
+	if err := out.Close(); err != nil {
+		l.logger.Error("output", zap.Error(err))
+	}
+	return summary, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"go.uber.org/zap"
+)
+
+// newSession creates a session for --profile. The region comes from
+// --region, or else from the environment or profile, so GovCloud and China
+// profiles work without extra flags.
+func newSession() (*session.Session, error) {
+	o := session.Options{
+		Profile:           opts.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if opts.Region != "" {
+		o.Config.Region = aws.String(opts.Region)
+	}
+	sess, err := session.NewSessionWithOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(defaultRegion)
+	}
+	return sess, nil
+}
+
+// IsExpiredCredentials reports whether err was caused by credentials that
+// have expired, e.g. an SSO or MFA session running out mid-run.
+func IsExpiredCredentials(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case "ExpiredTokenException", "ExpiredToken", "RequestExpired":
+			return true
+		}
+	}
+	return false
+}
+
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// reauthState serializes Reauth across the copies of Logs the searches hold.
+type reauthState struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+// Reauth asks the user to refresh their credentials and rebuilds the client
+// from a fresh session once they confirm. Concurrent searches that hit the
+// expiry while another one is prompting wait for it instead of asking again.
+func (l *Logs) Reauth(ctx context.Context, cause error) error {
+	if !isInteractive() {
+		return cause
+	}
+	failed := time.Now()
+	l.auth.mu.Lock()
+	defer l.auth.mu.Unlock()
+	if l.auth.at.After(failed) {
+		return nil
+	}
+	l.logger.Warn("credentials expired", zap.Error(cause))
+	hint := "aws sso login"
+	if opts.Profile != "" {
+		hint += " --profile " + opts.Profile
+	}
+	fmt.Fprintf(os.Stderr, "AWS credentials have expired. Refresh them (e.g. `%s`) and press Enter to resume: ", hint)
+	read := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		read <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-read:
+		if err != nil {
+			return cause
+		}
+	}
+
+	sess, err := newSession()
+	if err != nil {
+		return err
+	}
+	l.setClients(sess)
+	l.auth.at = time.Now()
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type benchCommand struct {
+	Term       string        `long:"term" description:"literal text to search for" required:"true"`
+	Sample     time.Duration `long:"sample" description:"length of the window searched, starting at --start" default:"15m"`
+	PricePerGB float64       `long:"price-per-gb" description:"Insights price per GB scanned in your region" default:"0.005"`
+}
+
+var benchOpts benchCommand
+
+// benchRun is the outcome of searching one group with one engine.
+type benchRun struct {
+	Group        string
+	Engine       string
+	Latency      time.Duration
+	Matches      int
+	BytesScanned float64
+	Cost         float64
+	Err          error
+}
+
+// insightsLiteral quotes term for use in an Insights filter.
+func insightsLiteral(term string) string {
+	return strconv.Quote(term)
+}
+
+// filterPatternLiteral quotes term as an exact phrase filter pattern.
+func filterPatternLiteral(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `\"`) + `"`
+}
+
+func runBench(ctx context.Context, l *Logs) error {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return err
+	}
+	if sampled := from.Add(benchOpts.Sample); sampled.Before(to) {
+		to = sampled
+	}
+
+	query := "fields @timestamp, @message, @logStream | filter @message like " + insightsLiteral(benchOpts.Term) + " | limit 10000"
+	pattern := filterPatternLiteral(benchOpts.Term)
+
+	groups, err := l.groupNames(ctx)
+	if err != nil {
+		return err
+	}
+	var runs []benchRun
+	for _, group := range groups {
+		if ctx.Err() != nil {
+			break
+		}
+
+		br := benchRun{Group: group, Engine: "insights"}
+		started := time.Now()
+		id, err := l.StartQuery(ctx, group, query, from, to)
+		if err == nil {
+			var res []QueryResult
+			var meta *QueryMeta
+			res, meta, err = resume(ctx, l, group, query, id)
+			if err == nil {
+				br.Matches = len(res)
+				if meta.Statistics != nil {
+					br.BytesScanned = meta.Statistics.BytesScanned
+					br.Cost = br.BytesScanned / (1 << 30) * benchOpts.PricePerGB
+				}
+			}
+		}
+		br.Latency, br.Err = time.Since(started), err
+		runs = append(runs, br)
+
+		br = benchRun{Group: group, Engine: "filter"}
+		started = time.Now()
+		res, pages, err := l.FilterEvents(ctx, group, pattern, from, to)
+		br.Latency, br.Matches, br.Err = time.Since(started), len(res), err
+		l.logger.Debug("filter", zap.String("group", group), zap.Int("pages", pages))
+		runs = append(runs, br)
+	}
+
+	return printBench(stdout, runs)
+}
+
+func printBench(w io.Writer, runs []benchRun) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tENGINE\tLATENCY\tMATCHES\tBYTES SCANNED\tEST. COST\tERROR")
+	for _, r := range runs {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.0f\t$%.6f\t%s\n",
+			r.Group, r.Engine, r.Latency.Round(time.Millisecond), r.Matches, r.BytesScanned, r.Cost, errText)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cacheEntry is the stored outcome of one successful search of a group.
+type cacheEntry struct {
+	Created time.Time
+	Meta    *QueryMeta
+	Results []QueryResult
+}
+
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloud-watch-client", "results"), nil
+}
+
+// cacheKey identifies a search by everything that affects its results.
+func cacheKey(t Target, query string) string {
+	h := sha256.New()
+	for _, part := range []string{opts.Profile, opts.Region, t.Group, t.Engine, t.Pattern, query, opts.Start, opts.End, opts.MultiLine, opts.MultiGap.String()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCache returns the entry stored under key if it is younger than ttl.
+func loadCache(key string, ttl time.Duration) (*cacheEntry, bool) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || e.Meta == nil {
+		return nil, false
+	}
+	if time.Since(e.Created) > ttl {
+		os.Remove(filepath.Join(dir, key+".json"))
+		return nil, false
+	}
+	return &e, true
+}
+
+var pruneOnce sync.Once
+
+// pruneCache removes the entries, and temporary files left by interrupted
+// stores, that were written more than ttl ago. Every run with a new --end
+// adds entries, so without this the cache would only grow.
+func pruneCache(dir string, ttl time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if time.Since(info.ModTime()) > ttl {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func storeCache(key string, e *cacheEntry) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	pruneOnce.Do(func() { pruneCache(dir, opts.CacheTTL) })
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+key+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, key+".json"))
+}
+
+// cacheable reports whether a search over the current window may be served
+// from the cache. A window that ends in the future can still gain events.
+func cacheable() bool {
+	if opts.NoCache || opts.CacheTTL <= 0 {
+		return false
+	}
+	to, err := ParseTime(opts.End)
+	return err == nil && to.Before(time.Now())
+}
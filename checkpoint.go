@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointQuery is a query that was still running when the run stopped.
+// Insights keeps running it, and results can fetch it later.
+type checkpointQuery struct {
+	ID     string `json:"id"`
+	Group  string `json:"group"`
+	Region string `json:"region"`
+}
+
+// checkpoint records what an interrupted search didn't finish.
+type checkpoint struct {
+	Created time.Time         `json:"created"`
+	Name    string            `json:"name,omitempty"`
+	Start   string            `json:"start"`
+	End     string            `json:"end"`
+	Queries []checkpointQuery `json:"queries"`
+	Skipped []string          `json:"skipped"`
+}
+
+func checkpointPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloud-watch-client", "checkpoint.json"), nil
+}
+
+// writeCheckpoint saves the queries still running and the groups that were
+// never queried, and returns the path it wrote.
+func writeCheckpoint(queries []checkpointQuery, summary *Summary) (string, error) {
+	running := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		running[q.Group] = true
+		running[q.Region+":"+q.Group] = true
+	}
+	cp := checkpoint{
+		Created: time.Now(),
+		Name:    opts.Name,
+		Start:   opts.Start,
+		End:     opts.End,
+		Queries: queries,
+		Skipped: []string{},
+	}
+	for _, g := range summary.Skipped {
+		if !running[g] {
+			cp.Skipped = append(cp.Skipped, g)
+		}
+	}
+
+	path, err := checkpointPath()
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+func loadCheckpoint() (*checkpoint, error) {
+	path, err := checkpointPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cp, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+)
+
+type resultsCommand struct {
+	QueryID    string `long:"query-id" description:"ID of a query started elsewhere; more IDs can be given as arguments or on stdin with -"`
+	Group      string `long:"group" description:"log group name to label the results with"`
+	Checkpoint bool   `long:"checkpoint" description:"fetch the queries that were still running when the last search was interrupted"`
+}
+
+var resultsOpts resultsCommand
+
+func addCommands(parser *flags.Parser) {
+	parser.AddCommand("results", "Fetch the results of an existing query",
+		"Skip StartQuery and wait for the results of a query started elsewhere, e.g. in the console or by another run.",
+		&resultsOpts)
+	parser.AddCommand("queries", "Manage running Insights queries",
+		"List or cancel queries that are running or scheduled, e.g. stuck queries holding the concurrency quota.",
+		&queriesOpts)
+	parser.AddCommand("report", "Generate a shareable report",
+		"Write the search as a single HTML report, or as a Grafana dashboard that keeps running it.",
+		&reportOpts)
+	parser.AddCommand("bench", "Compare Insights and FilterLogEvents",
+		"Search a sample window with both engines and report the latency, number of matches and estimated cost of each.",
+		&benchOpts)
+	parser.AddCommand("top-errors", "List the most frequent error fingerprints",
+		"Fingerprint the results, count them per group and compare each count with the window just before --start.",
+		&topErrorsOpts)
+	parser.AddCommand("context", "Manage named contexts",
+		"List the contexts defined in the config, or choose the one used when --context isn't given.",
+		&contextOpts)
+	parser.AddCommand("metrics", "Show CloudWatch metrics next to log matches",
+		"Fetch metrics with GetMetricData for the same window and print them bucket by bucket alongside the number of log matches.",
+		&metricsOpts)
+	parser.AddCommand("alarms", "Show CloudWatch alarm activity",
+		"Put the state changes of alarms on the groups' metric filters, and of any --alarm, into the log timeline.",
+		&alarmsOpts)
+}
+
+// runCommand runs the subcommand selected on the command line. Commands that
+// don't query log groups return a nil summary.
+func runCommand(ctx context.Context, cmd *flags.Command, l *Logs) (*Summary, error) {
+	switch cmd.Name {
+	case "results":
+		return runResults(ctx, l)
+	case "queries":
+		switch cmd.Active.Name {
+		case "list":
+			return nil, runQueriesList(ctx, l)
+		case "cancel":
+			return nil, runQueriesCancel(ctx, l)
+		}
+	case "alarms":
+		switch cmd.Active.Name {
+		case "history":
+			return runAlarmsHistory(ctx, l)
+		}
+	case "metrics":
+		return runMetrics(ctx, l)
+	case "top-errors":
+		return runTopErrors(ctx, l)
+	case "bench":
+		return nil, runBench(ctx, l)
+	case "report":
+		switch cmd.Active.Name {
+		case "html":
+			return runReportHTML(ctx, l)
+		case "grafana":
+			return nil, runReportGrafana(ctx, l)
+		}
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd.Name)
+}
+
+// runResults attaches to the given query IDs. The queries were not started by
+// this run, so they are left running if the run is interrupted.
+func runResults(ctx context.Context, l *Logs) (*Summary, error) {
+	var ids []string
+	if resultsOpts.QueryID != "" {
+		var err error
+		if ids, err = readNames([]string{resultsOpts.QueryID}, os.Stdin); err != nil {
+			return nil, err
+		}
+	}
+	ids = append(ids, names...)
+	groups := make(map[string]string)
+	if resultsOpts.Checkpoint {
+		cp, err := loadCheckpoint()
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range cp.Queries {
+			if q.Region != opts.Region {
+				l.logger.Warn("checkpoint query in another region", zap.String("id", q.ID), zap.String("region", q.Region))
+				continue
+			}
+			ids = append(ids, q.ID)
+			groups[q.ID] = q.Group
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("specify a query ID with --query-id, as an argument or on stdin with -")
+	}
+
+	out, err := newOutput()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			l.logger.Error("output", zap.Error(err))
+		}
+	}()
+
+	summary := &Summary{}
+	for _, id := range ids {
+		group := resultsOpts.Group
+		if g, ok := groups[id]; ok && group == "" {
+			group = g
+		}
+		known := group != ""
+		if !known {
+			group = id
+		}
+		if ctx.Err() != nil {
+			summary.Skipped = append(summary.Skipped, group)
+			continue
+		}
+
+		res, meta, err := resume(ctx, l, group, "", id)
+		if ctx.Err() != nil {
+			summary.Skipped = append(summary.Skipped, group)
+			continue
+		}
+		if err != nil {
+			summary.Failed = append(summary.Failed, GroupFailure{Group: group, Err: err})
+			continue
+		}
+		if known {
+			res = continuations(ctx, l, group, res)
+		} else {
+			res = Reassemble(res, recordStart, opts.MultiGap)
+		}
+		summary.record(ctx, l, meta, res, out)
+	}
+	return summary, nil
+}
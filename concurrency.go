@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.uber.org/zap"
+)
+
+// limiter bounds how many groups are searched at once. The limit grows by
+// one for every limit's worth of fast calls and halves when a call is
+// throttled or slows down past twice its usual latency, so large fan-outs
+// run as wide as the account allows without tripping its limits.
+type limiter struct {
+	mu       sync.Mutex
+	logger   *zap.Logger
+	limit    float64
+	max      float64
+	inUse    int
+	wake     chan struct{}
+	backoff  time.Time
+	baseline map[string]time.Duration
+}
+
+const (
+	limiterStart    = 2
+	limiterCooldown = 2 * time.Second
+)
+
+func newLimiter(max int, logger *zap.Logger) *limiter {
+	if max < 1 {
+		max = 1
+	}
+	start := limiterStart
+	if start > max {
+		start = max
+	}
+	return &limiter{
+		logger:   logger,
+		limit:    float64(start),
+		max:      float64(max),
+		wake:     make(chan struct{}),
+		baseline: make(map[string]time.Duration),
+	}
+}
+
+// acquire blocks until a slot is free or ctx is done.
+func (c *limiter) acquire(ctx context.Context) error {
+	c.mu.Lock()
+	for c.inUse >= int(c.limit) {
+		wake := c.wake
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+		c.mu.Lock()
+	}
+	c.inUse++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *limiter) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse--
+	c.broadcast()
+}
+
+// broadcast wakes every waiting acquire. c.mu must be held.
+func (c *limiter) broadcast() {
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
+
+// observe adjusts the limit after an API call on op that took latency.
+func (c *limiter) observe(op string, throttled bool, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	base, ok := c.baseline[op]
+	if !ok || latency < base {
+		c.baseline[op] = latency
+		base = latency
+	}
+	if throttled || latency > 2*base && latency > time.Second {
+		// Several in-flight calls see the same pressure; only back off
+		// once for them.
+		if time.Now().Before(c.backoff) {
+			return
+		}
+		c.backoff = time.Now().Add(limiterCooldown)
+		c.limit /= 2
+		if c.limit < 1 {
+			c.limit = 1
+		}
+		c.logger.Debug("concurrency down", zap.String("op", op), zap.Bool("throttled", throttled), zap.Duration("latency", latency), zap.Int("limit", int(c.limit)))
+		return
+	}
+
+	prev := int(c.limit)
+	c.limit += 1 / c.limit
+	if c.limit > c.max {
+		c.limit = c.max
+	}
+	if int(c.limit) > prev {
+		c.logger.Debug("concurrency up", zap.Int("limit", int(c.limit)))
+		c.broadcast()
+	}
+}
+
+// instrument reports every call made through h to the limiter. Calls the SDK
+// had to retry count as throttled: by the time they complete, the error that
+// caused the retry is gone.
+func (c *limiter) instrument(h *request.Handlers) {
+	h.Complete.PushBack(func(r *request.Request) {
+		throttled := r.RetryCount > 0 || r.Error != nil && request.IsErrorThrottle(r.Error)
+		c.observe(r.Operation.Name, throttled, time.Since(r.AttemptTime))
+	})
+}
+
+// fanOut calls fn for each target, running as many at once as the limiter
+// allows. Targets that can't start before ctx is done are passed to skip.
+func (c *limiter) fanOut(ctx context.Context, targets []Target, fn func(Target), skip func(Target)) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if err := c.acquire(ctx); err != nil {
+			skip(t)
+			continue
+		}
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			defer c.release()
+			fn(t)
+		}(t)
+	}
+	wg.Wait()
+}
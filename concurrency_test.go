@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLimiterObserve(t *testing.T) {
+	type call struct {
+		throttled bool
+		latency   time.Duration
+		cooled    bool // the cooldown of the previous backoff has passed
+	}
+	fast := call{latency: 100 * time.Millisecond}
+	throttle := call{throttled: true, latency: 100 * time.Millisecond}
+	tests := []struct {
+		name  string
+		max   int
+		limit float64
+		calls []call
+		want  int
+	}{
+		{name: "grows by one per limit's worth of calls", max: 10, limit: 2, calls: []call{fast, fast}, want: 2},
+		{name: "third fast call crosses 3", max: 10, limit: 2, calls: []call{fast, fast, fast}, want: 3},
+		{name: "throttle halves", max: 10, limit: 8, calls: []call{throttle}, want: 4},
+		{name: "throttles in the cooldown back off once", max: 10, limit: 8, calls: []call{throttle, throttle}, want: 4},
+		{name: "throttle after the cooldown halves again", max: 10, limit: 8, calls: []call{throttle, {throttled: true, cooled: true}}, want: 2},
+		{name: "over twice the baseline and a second halves", max: 10, limit: 8, calls: []call{fast, {latency: 1500 * time.Millisecond}}, want: 4},
+		{name: "slow but under a second grows", max: 10, limit: 7.9, calls: []call{fast, {latency: 900 * time.Millisecond}}, want: 8},
+		{name: "clamped to max", max: 3, limit: 3, calls: []call{fast, fast, fast, fast, fast}, want: 3},
+		{name: "clamped to 1", max: 10, limit: 1, calls: []call{throttle, {throttled: true, cooled: true}}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLimiter(tt.max, zap.NewNop())
+			c.limit = tt.limit
+			for _, call := range tt.calls {
+				if call.cooled {
+					c.backoff = time.Time{}
+				}
+				c.observe("StartQuery", call.throttled, call.latency)
+			}
+			if got := int(c.limit); got != tt.want {
+				t.Errorf("limit = %d (%.2f), want %d", got, c.limit, tt.want)
+			}
+			if c.limit > float64(tt.max) || c.limit < 1 {
+				t.Errorf("limit %.2f outside [1, %d]", c.limit, tt.max)
+			}
+		})
+	}
+}
+
+func TestNewLimiterClamps(t *testing.T) {
+	for _, tt := range []struct{ max, want int }{{0, 1}, {1, 1}, {10, limiterStart}} {
+		if got := int(newLimiter(tt.max, zap.NewNop()).limit); got != tt.want {
+			t.Errorf("newLimiter(%d) starts at %d, want %d", tt.max, got, tt.want)
+		}
+	}
+}
+
+// A waiting acquire must wake up as soon as the limit grows, not only when
+// a slot is released.
+func TestLimiterWakesOnGrowth(t *testing.T) {
+	c := newLimiter(10, zap.NewNop())
+	c.limit = 1
+	if err := c.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- c.acquire(context.Background()) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire succeeded past the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.observe("StartQuery", false, 100*time.Millisecond)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire not woken when the limit grew")
+	}
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	c := newLimiter(1, zap.NewNop())
+	if err := c.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.acquire(ctx); err == nil {
+		t.Error("acquire past the limit succeeded, want the context error")
+	}
+}
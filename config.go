@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config is the optional JSON configuration file.
+type Config struct {
+	Windows  map[string]WindowPolicy  `json:"windows"`
+	Sinks    map[string]SinkConfig    `json:"sinks"`
+	Parsers  map[string]ParserConfig  `json:"parsers"`
+	Groups   map[string]GroupConfig   `json:"groups"`
+	Contexts map[string]ContextConfig `json:"contexts"`
+}
+
+// WindowPolicy restricts results to recurring hours and days, minus fixed
+// exclusion ranges such as maintenance windows.
+type WindowPolicy struct {
+	Timezone string      `json:"timezone"`
+	Days     []string    `json:"days"`
+	Hours    string      `json:"hours"`
+	Exclude  []TimeRange `json:"exclude"`
+}
+
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+var conf Config
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "cloud-watch-client", "config.json")
+}
+
+// loadConfig reads path. A missing file is only an error when the path was
+// given explicitly.
+func loadConfig(path string, explicit bool) (Config, error) {
+	var c Config
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// timeWindow is a compiled WindowPolicy.
+type timeWindow struct {
+	loc      *time.Location
+	days     [7]bool
+	hasHours bool
+	from, to time.Duration
+	exclude  []TimeRange
+}
+
+var weekdays = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func compileWindow(p WindowPolicy) (*timeWindow, error) {
+	w := &timeWindow{loc: time.UTC, exclude: p.Exclude}
+	if p.Timezone != "" {
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		w.loc = loc
+	}
+
+	if len(p.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, d := range p.Days {
+		days, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", d)
+		}
+		for _, day := range days {
+			w.days[day] = true
+		}
+	}
+
+	if p.Hours != "" {
+		from, to, ok := strings.Cut(p.Hours, "-")
+		if !ok {
+			return nil, fmt.Errorf("hours %q must look like 09:00-18:00", p.Hours)
+		}
+		var err error
+		if w.from, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if w.to, err = parseClock(to); err != nil {
+			return nil, err
+		}
+		w.hasHours = true
+	}
+	return w, nil
+}
+
+// Allows reports whether t falls inside the window. Hours whose end is before
+// their start wrap past midnight.
+func (w *timeWindow) Allows(t time.Time) bool {
+	for _, r := range w.exclude {
+		if !t.Before(r.Start) && t.Before(r.End) {
+			return false
+		}
+	}
+	local := t.In(w.loc)
+	if !w.days[local.Weekday()] {
+		return false
+	}
+	if !w.hasHours {
+		return true
+	}
+	// Wall-clock time of day, so days that change to or from DST still
+	// open and close at the configured hours.
+	h, m, sec := local.Clock()
+	clock := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if w.from <= w.to {
+		return clock >= w.from && clock < w.to
+	}
+	return clock >= w.from || clock < w.to
+}
+
+// window is the policy selected with --window, if any.
+var window *timeWindow
+
+func selectWindow(name string) error {
+	if name == "" {
+		return nil
+	}
+	p, ok := conf.Windows[name]
+	if !ok {
+		return fmt.Errorf("no window %q in config", name)
+	}
+	w, err := compileWindow(p)
+	if err != nil {
+		return fmt.Errorf("window %q: %w", name, err)
+	}
+	window = w
+	return nil
+}
+
+func filterWindow(res []QueryResult) []QueryResult {
+	if window == nil {
+		return res
+	}
+	kept := res[:0]
+	for _, r := range res {
+		t, err := time.Parse(insightsTimeLayout, r.Timestamp)
+		if err != nil || window.Allows(t) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestCompileWindowErrors(t *testing.T) {
+	tests := []WindowPolicy{
+		{Timezone: "Nowhere/City"},
+		{Days: []string{"funday"}},
+		{Hours: "09:00"},
+		{Hours: "9-18"},
+	}
+	for _, p := range tests {
+		if _, err := compileWindow(p); err == nil {
+			t.Errorf("compileWindow(%+v) succeeded, want error", p)
+		}
+	}
+}
+
+func TestWindowAllows(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	newYork, _ := time.LoadLocation("America/New_York")
+	maintenance := TimeRange{
+		Start: time.Date(2022, 9, 21, 1, 0, 0, 0, time.UTC),
+		End:   time.Date(2022, 9, 21, 2, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name   string
+		policy WindowPolicy
+		at     time.Time
+		want   bool
+	}{
+		{"no restrictions", WindowPolicy{}, time.Date(2022, 9, 18, 3, 0, 0, 0, time.UTC), true},
+		{"business hours inside", WindowPolicy{Hours: "09:00-18:00"}, time.Date(2022, 9, 21, 9, 0, 0, 0, time.UTC), true},
+		{"business hours end is exclusive", WindowPolicy{Hours: "09:00-18:00"}, time.Date(2022, 9, 21, 18, 0, 0, 0, time.UTC), false},
+		{"business hours before", WindowPolicy{Hours: "09:00-18:00"}, time.Date(2022, 9, 21, 8, 59, 0, 0, time.UTC), false},
+		{"overnight late", WindowPolicy{Hours: "22:00-06:00"}, time.Date(2022, 9, 21, 23, 30, 0, 0, time.UTC), true},
+		{"overnight early", WindowPolicy{Hours: "22:00-06:00"}, time.Date(2022, 9, 21, 5, 59, 0, 0, time.UTC), true},
+		{"overnight midday", WindowPolicy{Hours: "22:00-06:00"}, time.Date(2022, 9, 21, 12, 0, 0, 0, time.UTC), false},
+		{"weekdays on wednesday", WindowPolicy{Days: []string{"weekdays"}}, time.Date(2022, 9, 21, 12, 0, 0, 0, time.UTC), true},
+		{"weekdays on sunday", WindowPolicy{Days: []string{"weekdays"}}, time.Date(2022, 9, 18, 12, 0, 0, 0, time.UTC), false},
+		{"day names are case-insensitive", WindowPolicy{Days: []string{"Sun"}}, time.Date(2022, 9, 18, 12, 0, 0, 0, time.UTC), true},
+		// 2022-09-20 23:00 UTC is Wednesday 08:00 in Tokyo.
+		{"timezone shifts the day", WindowPolicy{Timezone: "Asia/Tokyo", Days: []string{"wed"}}, time.Date(2022, 9, 20, 23, 0, 0, 0, time.UTC), true},
+		{"timezone shifts the hours", WindowPolicy{Timezone: "Asia/Tokyo", Hours: "09:00-18:00"}, time.Date(2022, 9, 21, 0, 0, 0, 0, tokyo).Add(9 * time.Hour), true},
+		{"excluded range", WindowPolicy{Exclude: []TimeRange{maintenance}}, time.Date(2022, 9, 21, 1, 30, 0, 0, time.UTC), false},
+		{"excluded range end is exclusive", WindowPolicy{Exclude: []TimeRange{maintenance}}, maintenance.End, true},
+		{"exclusion wins over hours", WindowPolicy{Hours: "00:00-23:59", Exclude: []TimeRange{maintenance}}, maintenance.Start, false},
+		// DST starts at 02:00 on 2022-03-13 in New York, so 09:30 is only
+		// 8.5 hours after midnight.
+		{"dst start", WindowPolicy{Timezone: "America/New_York", Hours: "09:00-17:00"}, time.Date(2022, 3, 13, 9, 30, 0, 0, newYork), true},
+		{"dst start before opening", WindowPolicy{Timezone: "America/New_York", Hours: "09:00-17:00"}, time.Date(2022, 3, 13, 8, 30, 0, 0, newYork), false},
+		{"dst end", WindowPolicy{Timezone: "America/New_York", Hours: "09:00-17:00"}, time.Date(2022, 11, 6, 16, 30, 0, 0, newYork), true},
+		{"dst end after closing", WindowPolicy{Timezone: "America/New_York", Hours: "09:00-17:00"}, time.Date(2022, 11, 6, 17, 0, 0, 0, newYork), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := compileWindow(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Allows(tt.at); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// ContextConfig bundles the settings for one environment so switching
+// between them takes a single --context flag.
+type ContextConfig struct {
+	Profile string   `json:"profile"`
+	Region  string   `json:"region"`
+	Regions []string `json:"regions"`
+	Group   string   `json:"group"`
+	Groups  []string `json:"groups"`
+	Output  string   `json:"output"`
+}
+
+// regions returns the regions of the context, Region first.
+func (c ContextConfig) regions() []string {
+	var regions []string
+	if c.Region != "" {
+		regions = append(regions, c.Region)
+	}
+	for _, r := range c.Regions {
+		if r != c.Region {
+			regions = append(regions, r)
+		}
+	}
+	return regions
+}
+
+// moreRegions are the regions of the selected context after the first. The
+// search runs in each of them as well as in --region.
+var moreRegions []string
+
+type contextCommand struct {
+	Use  contextUseCommand  `command:"use" description:"Make a context the default"`
+	List contextListCommand `command:"list" description:"List the contexts in the config"`
+}
+
+type contextUseCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"name" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+type contextListCommand struct{}
+
+var contextOpts contextCommand
+
+func currentContextPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloud-watch-client", "current-context"), nil
+}
+
+// currentContext returns the context chosen with `context use`, if any.
+func currentContext() (string, error) {
+	path, err := currentContextPath()
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(b)), err
+}
+
+// applyContext fills in the options of the selected context that weren't
+// given on the command line. A saved current context that is no longer in
+// the config is ignored with a warning, so it can still be replaced with
+// `context use`.
+func applyContext(parser *flags.Parser) error {
+	name := opts.Context
+	if name == "" {
+		var err error
+		if name, err = currentContext(); err != nil || name == "" {
+			return err
+		}
+		if _, ok := conf.Contexts[name]; !ok {
+			fmt.Fprintf(os.Stderr, "ignoring current context %q: not in config\n", name)
+			return nil
+		}
+	}
+	c, ok := conf.Contexts[name]
+	if !ok {
+		return fmt.Errorf("no context %q in config", name)
+	}
+
+	set := func(opt *flags.Option, value string, dst *string) {
+		if value != "" && !opt.IsSet() {
+			*dst = value
+		}
+	}
+	set(parser.FindOptionByLongName("profile"), c.Profile, &opts.Profile)
+	set(parser.FindOptionByShortName('g'), c.Group, &opts.GroupName)
+	set(parser.FindOptionByLongName("output"), c.Output, &opts.Output)
+	if regions := c.regions(); len(regions) > 0 && !parser.FindOptionByLongName("region").IsSet() {
+		opts.Region, moreRegions = regions[0], regions[1:]
+	}
+	// results takes query IDs rather than groups as arguments.
+	searchesGroups := parser.Active == nil || parser.Active.Name != "results"
+	if len(names) == 0 && len(c.Groups) > 0 && searchesGroups && !parser.FindOptionByShortName('g').IsSet() {
+		names = append([]string(nil), c.Groups...)
+	}
+	return nil
+}
+
+// runContext runs the context subcommands. They only touch local files, so
+// they run before any AWS session is created.
+func runContext(cmd *flags.Command) error {
+	switch cmd.Active.Name {
+	case "use":
+		name := contextOpts.Use.Args.Name
+		if _, ok := conf.Contexts[name]; !ok {
+			return fmt.Errorf("no context %q in config", name)
+		}
+		path, err := currentContextPath()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(name+"\n"), 0o600)
+	case "list":
+		current, err := currentContext()
+		if err != nil {
+			return err
+		}
+		if opts.Context != "" {
+			current = opts.Context
+		}
+		names := make([]string, 0, len(conf.Contexts))
+		for name := range conf.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			mark := " "
+			if name == current {
+				mark = "*"
+			}
+			c := conf.Contexts[name]
+			group := c.Group
+			if len(c.Groups) > 0 {
+				group = strings.Join(c.Groups, ",")
+			}
+			fmt.Printf("%s %s\tprofile=%s region=%s group=%s\n", mark, name, c.Profile, strings.Join(c.regions(), ","), group)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", cmd.Active.Name)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+)
+
+// Search engines selectable with --engine.
+const (
+	engineAuto     = "auto"
+	engineInsights = "insights"
+	engineFilter   = "filter"
+)
+
+// Target is a log group together with the engine chosen to search it.
+type Target struct {
+	Group          string
+	Engine         string
+	Pattern        string
+	EstimatedBytes float64
+	LastEvent      time.Time
+}
+
+// simpleKeyword matches a --keyword that only looks for a literal string and
+// so can be expressed as a FilterLogEvents pattern.
+var simpleKeyword = regexp.MustCompile(`^like\s+(?:"([^"\\]*)"|'([^'\\]*)'|/([^/\\.*+?()\[\]{}|^$]*)/)$`)
+
+// FilterPattern translates keyword into an equivalent FilterLogEvents
+// pattern. It reports false when keyword needs Insights, e.g. regexes or
+// boolean expressions.
+func FilterPattern(keyword string) (string, bool) {
+	m := simpleKeyword.FindStringSubmatch(strings.TrimSpace(keyword))
+	if m == nil {
+		return "", false
+	}
+	term := m[1] + m[2] + m[3]
+	if term == "" {
+		return "", false
+	}
+	return `"` + term + `"`, true
+}
+
+// EstimateScanBytes estimates how many bytes a query over [from, to] scans in
+// g, assuming its stored bytes are spread evenly over its retention period
+// (or its lifetime when it never expires).
+func EstimateScanBytes(g *cloudwatchlogs.LogGroup, from, to, now time.Time) float64 {
+	stored := float64(aws.Int64Value(g.StoredBytes))
+	span := now.Sub(time.UnixMilli(aws.Int64Value(g.CreationTime)))
+	if days := aws.Int64Value(g.RetentionInDays); days > 0 {
+		if retention := time.Duration(days) * 24 * time.Hour; retention < span {
+			span = retention
+		}
+	}
+	window := to.Sub(from)
+	if span <= 0 || window >= span {
+		return stored
+	}
+	return stored * float64(window) / float64(span)
+}
+
+func chooseEngine(engine string, estimated float64, simple bool) string {
+	switch engine {
+	case engineInsights, engineFilter:
+		return engine
+	}
+	if simple && estimated <= opts.FilterMax*(1<<30) {
+		return engineFilter
+	}
+	return engineInsights
+}
+
+// PlanTargets lists the groups to search and picks an engine for each:
+// FilterLogEvents costs nothing per byte scanned, so it wins for small scans
+// of literal filters, while Insights handles large scans and anything else.
+func (l Logs) PlanTargets(ctx context.Context) ([]Target, error) {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, err
+	}
+	pattern, simple := FilterPattern(opts.KeyWord)
+	if opts.Engine == engineFilter && !simple {
+		return nil, fmt.Errorf("--keyword %q cannot be run with FilterLogEvents", opts.KeyWord)
+	}
+
+	groups, err := l.DescribeGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	targets := make([]Target, 0, len(groups))
+	for _, g := range groups {
+		estimated := EstimateScanBytes(g, from, to, now)
+		t := Target{
+			Group:          aws.StringValue(g.LogGroupName),
+			Engine:         chooseEngine(opts.Engine, estimated, simple),
+			Pattern:        pattern,
+			EstimatedBytes: estimated,
+		}
+		l.logger.Debug("engine", zap.String("group", t.Group), zap.String("engine", t.Engine), zap.Float64("estimated_bytes", estimated))
+		targets = append(targets, t)
+	}
+
+	if opts.Order == "recent" {
+		l.sortByActivity(ctx, targets)
+	}
+	return targets, nil
+}
+
+// LastEventTime returns the time of the latest event in any stream of
+// logGroup, or the zero time when it has no events.
+func (l Logs) LastEventTime(ctx context.Context, logGroup string) (time.Time, error) {
+	out, err := l.client().DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName: aws.String(logGroup),
+		OrderBy:      aws.String(cloudwatchlogs.OrderByLastEventTime),
+		Descending:   aws.Bool(true),
+		Limit:        aws.Int64(1),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(out.LogStreams) == 0 || out.LogStreams[0].LastEventTimestamp == nil {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(aws.Int64Value(out.LogStreams[0].LastEventTimestamp)), nil
+}
+
+// sortByActivity orders targets so the groups that received events most
+// recently are searched first; their results are the most likely to matter.
+// DescribeLogStreams has a low rate limit, so the lookups go through the
+// limiter like the searches do. Groups whose lookup fails or doesn't start
+// before ctx is done go last.
+func (l Logs) sortByActivity(ctx context.Context, targets []Target) {
+	var mu sync.Mutex
+	last := make(map[string]time.Time, len(targets))
+	l.limiter.fanOut(ctx, targets, func(t Target) {
+		at, err := l.LastEventTime(ctx, t.Group)
+		if err != nil {
+			l.logger.Debug("last event time", zap.String("group", t.Group), zap.Error(err))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		last[t.Group] = at
+	}, func(Target) {})
+	for i := range targets {
+		targets[i].LastEvent = last[targets[i].Group]
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].LastEvent.After(targets[j].LastEvent)
+	})
+}
+
+// CheckScanSize refuses a run whose estimated scan exceeds --max-scan-gb
+// unless --force is given, in which case it only warns.
+func (l Logs) CheckScanSize(targets []Target) error {
+	return l.checkScanSize(targets, 1)
+}
+
+// checkScanSize is CheckScanSize for a command that searches windows windows
+// of the same length as --start to --end.
+func (l Logs) checkScanSize(targets []Target, windows int) error {
+	var total float64
+	for _, t := range targets {
+		total += t.EstimatedBytes
+	}
+	total *= float64(windows)
+	gb := total / (1 << 30)
+	if opts.MaxScan <= 0 || gb <= opts.MaxScan {
+		return nil
+	}
+	if opts.Force {
+		l.logger.Warn("large scan", zap.Float64("estimated_gb", gb), zap.Float64("max_scan_gb", opts.MaxScan))
+		return nil
+	}
+	return fmt.Errorf("run would scan an estimated %.1f GB across %d groups, more than --max-scan-gb=%g; narrow the window or pass --force", gb, len(targets), opts.MaxScan)
+}
+
+func filterSearch(ctx context.Context, l *Logs, t Target) ([]QueryResult, *QueryMeta, error) {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, _, err := l.FilterEvents(ctx, t.Group, t.Pattern, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, &QueryMeta{Group: t.Group, Engine: engineFilter, Status: cloudwatchlogs.QueryStatusComplete}, nil
+}
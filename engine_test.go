@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestFilterPattern(t *testing.T) {
+	tests := []struct {
+		keyword, pattern string
+		simple           bool
+	}{
+		{`like "timeout"`, `"timeout"`, true},
+		{`like 'connection reset'`, `"connection reset"`, true},
+		{`like /ERROR/`, `"ERROR"`, true},
+		{`  like /ERROR/  `, `"ERROR"`, true},
+		{`like /ERR.R/`, "", false},
+		{`like /(?i)error/`, "", false},
+		{`like "a\"b"`, "", false},
+		{`like ""`, "", false},
+		{`like /ERROR/ and like /db/`, "", false},
+		{`not like /ERROR/`, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		pattern, simple := FilterPattern(tt.keyword)
+		if pattern != tt.pattern || simple != tt.simple {
+			t.Errorf("FilterPattern(%q) = %q, %v, want %q, %v", tt.keyword, pattern, simple, tt.pattern, tt.simple)
+		}
+	}
+}
+
+func TestEstimateScanBytes(t *testing.T) {
+	now := time.Date(2022, 9, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	group := func(stored int64, age time.Duration, retentionDays int64) *cloudwatchlogs.LogGroup {
+		g := &cloudwatchlogs.LogGroup{
+			StoredBytes:  aws.Int64(stored),
+			CreationTime: aws.Int64(now.Add(-age).UnixMilli()),
+		}
+		if retentionDays > 0 {
+			g.RetentionInDays = aws.Int64(retentionDays)
+		}
+		return g
+	}
+
+	tests := []struct {
+		name     string
+		group    *cloudwatchlogs.LogGroup
+		from, to time.Time
+		want     float64
+	}{
+		{"share of lifetime", group(10<<30, 10*day, 0), now.Add(-day), now, 1 << 30},
+		{"retention bounds the stored span", group(7<<30, 100*day, 7), now.Add(-day), now, 1 << 30},
+		{"window longer than the data", group(5<<30, 2*day, 0), now.Add(-30 * day), now, 5 << 30},
+		{"created in the future", group(1<<30, -day, 0), now.Add(-day), now, 1 << 30},
+		{"empty group", group(0, 10*day, 0), now.Add(-day), now, 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateScanBytes(tt.group, tt.from, tt.to, now); got != tt.want {
+			t.Errorf("%s: EstimateScanBytes = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChooseEngine(t *testing.T) {
+	saved := opts.FilterMax
+	defer func() { opts.FilterMax = saved }()
+	opts.FilterMax = 1
+
+	tests := []struct {
+		engine    string
+		estimated float64
+		simple    bool
+		want      string
+	}{
+		{engineAuto, 1 << 20, true, engineFilter},
+		{engineAuto, 2 << 30, true, engineInsights},
+		{engineAuto, 1 << 20, false, engineInsights},
+		{engineInsights, 1 << 20, true, engineInsights},
+		{engineFilter, 2 << 30, true, engineFilter},
+	}
+	for _, tt := range tests {
+		if got := chooseEngine(tt.engine, tt.estimated, tt.simple); got != tt.want {
+			t.Errorf("chooseEngine(%s, %g, %v) = %s, want %s", tt.engine, tt.estimated, tt.simple, got, tt.want)
+		}
+	}
+}
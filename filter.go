@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// FilterEvents searches logGroup over [from, to] with FilterLogEvents and
+// pattern, a CloudWatch Logs filter pattern. It also returns the number of
+// pages fetched.
+func (l Logs) FilterEvents(ctx context.Context, logGroup, pattern string, from, to time.Time) ([]QueryResult, int, error) {
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		FilterPattern: aws.String(pattern),
+		StartTime:     aws.Int64(UnixMillisecond(from)),
+		EndTime:       aws.Int64(UnixMillisecond(to)),
+	}
+	return l.filterEvents(ctx, input)
+}
+
+// StreamEvents returns every event of one stream in logGroup over
+// [from, to], oldest first.
+func (l Logs) StreamEvents(ctx context.Context, logGroup, stream string, from, to time.Time) ([]QueryResult, error) {
+	res, _, err := l.filterEvents(ctx, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(logGroup),
+		LogStreamNames: []*string{aws.String(stream)},
+		StartTime:      aws.Int64(UnixMillisecond(from)),
+		EndTime:        aws.Int64(UnixMillisecond(to)),
+	})
+	return res, err
+}
+
+func (l Logs) filterEvents(ctx context.Context, input *cloudwatchlogs.FilterLogEventsInput) ([]QueryResult, int, error) {
+	var result []QueryResult
+	pages := 0
+	err := l.client().FilterLogEventsPagesWithContext(ctx, input, func(out *cloudwatchlogs.FilterLogEventsOutput, last bool) bool {
+		pages++
+		for _, e := range out.Events {
+			result = append(result, QueryResult{
+				Timestamp: time.UnixMilli(aws.Int64Value(e.Timestamp)).UTC().Format(insightsTimeLayout),
+				LogStream: aws.StringValue(e.LogStreamName),
+				Message:   aws.StringValue(e.Message),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, pages, err
+	}
+	return result, pages, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// fingerprintRules strip the parts of a message that vary between
+// occurrences of the same error. Order matters: specific shapes first.
+var fingerprintRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`0x[0-9a-fA-F]+`), "<addr>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+`), "<n>"},
+	{regexp.MustCompile(`[ \t]+`), " "},
+}
+
+// Normalize returns msg with line numbers, addresses, IDs and timestamps
+// replaced by placeholders.
+func Normalize(msg string) string {
+	for _, r := range fingerprintRules {
+		msg = r.re.ReplaceAllString(msg, r.repl)
+	}
+	return strings.TrimSpace(msg)
+}
+
+// Fingerprint returns a stable short identifier for the normalized msg.
+func Fingerprint(msg string) string {
+	sum := sha1.Sum([]byte(Normalize(msg)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// FingerprintGroup summarizes every record sharing a fingerprint.
+type FingerprintGroup struct {
+	Fingerprint string         `json:"fingerprint"`
+	Count       int            `json:"count"`
+	FirstSeen   string         `json:"firstSeen"`
+	LastSeen    string         `json:"lastSeen"`
+	Groups      map[string]int `json:"groups"`
+	Sample      string         `json:"sample"`
+}
+
+// GroupByFingerprint groups records by fingerprint, most frequent first.
+func GroupByFingerprint(records []record) []*FingerprintGroup {
+	byPrint := make(map[string]*FingerprintGroup)
+	var groups []*FingerprintGroup
+	for _, r := range records {
+		fp := Fingerprint(r.Message)
+		g, ok := byPrint[fp]
+		if !ok {
+			g = &FingerprintGroup{Fingerprint: fp, FirstSeen: r.Timestamp, LastSeen: r.Timestamp, Groups: make(map[string]int), Sample: r.Message}
+			byPrint[fp] = g
+			groups = append(groups, g)
+		}
+		g.Count++
+		g.Groups[r.Group]++
+		// Insights timestamps sort lexically.
+		if r.Timestamp < g.FirstSeen {
+			g.FirstSeen = r.Timestamp
+		}
+		if r.Timestamp > g.LastSeen {
+			g.LastSeen = r.Timestamp
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return groups
+}
+
+// fingerprintFormatter replaces the individual results with one line per
+// fingerprint.
+type fingerprintFormatter struct {
+	*collector
+	w      io.Writer
+	format string
+}
+
+func (f *fingerprintFormatter) Close() error {
+	groups := GroupByFingerprint(f.records)
+	switch f.format {
+	case "json":
+		enc := json.NewEncoder(f.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	case "ndjson":
+		enc := json.NewEncoder(f.w)
+		for _, g := range groups {
+			if err := enc.Encode(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(f.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINGERPRINT\tCOUNT\tFIRST SEEN\tLAST SEEN\tGROUPS\tSAMPLE")
+	for _, g := range groups {
+		sample := truncate(strings.SplitN(g.Sample, "\n", 2)[0], 120, "…")
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\n", g.Fingerprint, g.Count, g.FirstSeen, g.LastSeen, len(g.Groups), sample)
+	}
+	return tw.Flush()
+}
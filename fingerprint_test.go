@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		msg, want string
+	}{
+		{"request 3f2b8c1e-9a4d-4e2f-8b1a-0c5d6e7f8a9b failed", "request <uuid> failed"},
+		{"2022-09-22T00:01:02.345+09:00 ERROR boom", "<time> ERROR boom"},
+		{"at 2022-09-22 00:01:02,345Z ERROR boom", "at <time> ERROR boom"},
+		{"panic at 0x7ffd5e8c", "panic at <addr>"},
+		{"trace deadbeefcafebabe0123 lost", "trace <hex> lost"},
+		{"\tat com.foo.Bar.baz(Bar.java:123)", "at com.foo.Bar.baz(Bar.java:<n>)"},
+		{"timeout   after\t30s", "timeout after <n>s"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.msg); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("user 42 not found (request 3f2b8c1e-9a4d-4e2f-8b1a-0c5d6e7f8a9b)")
+	b := Fingerprint("user 7 not found  (request 0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d)")
+	if a != b {
+		t.Errorf("fingerprints of the same error differ: %s, %s", a, b)
+	}
+	if len(a) != 12 {
+		t.Errorf("fingerprint %q has %d characters, want 12", a, len(a))
+	}
+	if c := Fingerprint("user 42 deleted"); c == a {
+		t.Errorf("different errors share fingerprint %s", a)
+	}
+}
+
+func TestGroupByFingerprint(t *testing.T) {
+	records := []record{
+		{Timestamp: "2022-09-22 00:00:02.000", Message: "timeout after 30s", Group: "/a"},
+		{Timestamp: "2022-09-22 00:00:01.000", Message: "disk full", Group: "/a"},
+		{Timestamp: "2022-09-22 00:00:03.000", Message: "timeout after 5s", Group: "/b"},
+		{Timestamp: "2022-09-22 00:00:00.000", Message: "timeout after 12s", Group: "/a"},
+	}
+	groups := GroupByFingerprint(records)
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	g := groups[0]
+	if g.Count != 3 || g.Groups["/a"] != 2 || g.Groups["/b"] != 1 {
+		t.Errorf("most frequent group = %+v", g)
+	}
+	if g.FirstSeen != "2022-09-22 00:00:00.000" || g.LastSeen != "2022-09-22 00:00:03.000" {
+		t.Errorf("seen %s to %s", g.FirstSeen, g.LastSeen)
+	}
+	if g.Sample != "timeout after 30s" {
+		t.Errorf("sample = %q, want the first record", g.Sample)
+	}
+}
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/aws/aws-sdk-go v1.44.113
+	github.com/expr-lang/expr v1.17.8
 	github.com/jessevdk/go-flags v1.5.0
 	go.uber.org/zap v1.23.0
 )
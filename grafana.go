@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+type reportGrafanaCommand struct {
+	File       string `short:"f" long:"file" description:"write the dashboard to this file instead of stdout"`
+	Title      string `long:"title" description:"dashboard title" default:"CloudWatch Logs"`
+	Datasource string `long:"datasource" description:"UID of the CloudWatch datasource; when empty the dashboard asks for one on import"`
+	Interval   string `long:"interval" description:"bin size of the match count panel" default:"5m"`
+}
+
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaTarget struct {
+	Datasource    grafanaDatasource `json:"datasource"`
+	RefID         string            `json:"refId"`
+	QueryMode     string            `json:"queryMode"`
+	Region        string            `json:"region"`
+	Expression    string            `json:"expression"`
+	LogGroupNames []string          `json:"logGroupNames"`
+	StatsGroups   []string          `json:"statsGroups"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaPanel struct {
+	ID         int               `json:"id"`
+	Type       string            `json:"type"`
+	Title      string            `json:"title"`
+	Datasource grafanaDatasource `json:"datasource"`
+	GridPos    grafanaGridPos    `json:"gridPos"`
+	Targets    []grafanaTarget   `json:"targets"`
+}
+
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type grafanaDashboard struct {
+	Title         string         `json:"title"`
+	Tags          []string       `json:"tags"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Time          grafanaTime    `json:"time"`
+	Templating    grafanaVarList `json:"templating"`
+	Panels        []grafanaPanel `json:"panels"`
+}
+
+type grafanaTime struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaVarList struct {
+	List []grafanaVariable `json:"list"`
+}
+
+// newGrafanaDashboard builds a dashboard with a match count panel and a logs
+// panel running query against groups.
+func newGrafanaDashboard(title, datasourceUID, region, interval, query string, groups []string) grafanaDashboard {
+	ds := grafanaDatasource{Type: "cloudwatch", UID: datasourceUID}
+	var vars []grafanaVariable
+	if datasourceUID == "" {
+		ds.UID = "${datasource}"
+		vars = append(vars, grafanaVariable{Name: "datasource", Label: "CloudWatch", Type: "datasource", Query: "cloudwatch"})
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+
+	target := func(expr string) grafanaTarget {
+		return grafanaTarget{
+			Datasource:    ds,
+			RefID:         "A",
+			QueryMode:     "Logs",
+			Region:        region,
+			Expression:    expr,
+			LogGroupNames: groups,
+			StatsGroups:   []string{},
+		}
+	}
+	count := target(query + " | stats count(*) as matches by bin(" + interval + ")")
+	count.StatsGroups = []string{"bin(" + interval + ")"}
+
+	return grafanaDashboard{
+		Title:         title,
+		Tags:          []string{"cloudwatch-logs"},
+		SchemaVersion: 36,
+		Time:          grafanaTime{From: "now-6h", To: "now"},
+		Templating:    grafanaVarList{List: vars},
+		Panels: []grafanaPanel{
+			{
+				ID:         1,
+				Type:       "timeseries",
+				Title:      "Matches",
+				Datasource: ds,
+				GridPos:    grafanaGridPos{H: 8, W: 24, X: 0, Y: 0},
+				Targets:    []grafanaTarget{count},
+			},
+			{
+				ID:         2,
+				Type:       "logs",
+				Title:      "Logs",
+				Datasource: ds,
+				GridPos:    grafanaGridPos{H: 16, W: 24, X: 0, Y: 8},
+				Targets:    []grafanaTarget{target(query)},
+			},
+		},
+	}
+}
+
+func runReportGrafana(ctx context.Context, l *Logs) error {
+	c := reportOpts.Grafana
+	q, err := assembleQuery(l)
+	if err != nil {
+		return err
+	}
+	groups, err := l.groupNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(stdout)
+	if c.File != "" {
+		file, err := os.Create(c.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newGrafanaDashboard(c.Title, c.Datasource, opts.Region, c.Interval, q, groups))
+}
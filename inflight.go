@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+)
+
+// inflight tracks query IDs that have been started but not yet finished, so
+// they can be stopped server-side if the run is abandoned, or checkpointed
+// if it is interrupted. Each query keeps the clients of the region it was
+// started in, since a query can only be stopped there.
+type inflight struct {
+	mu   sync.Mutex
+	ids  map[string]checkpointQuery
+	apis map[string]*atomic.Pointer[clients]
+}
+
+func newInflight() *inflight {
+	return &inflight{ids: make(map[string]checkpointQuery), apis: make(map[string]*atomic.Pointer[clients])}
+}
+
+func (f *inflight) add(id, group string, api *atomic.Pointer[clients]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ids[id] = checkpointQuery{ID: id, Group: group, Region: opts.Region}
+	f.apis[id] = api
+}
+
+func (f *inflight) remove(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.ids, id)
+	delete(f.apis, id)
+}
+
+// api returns the clients of the region query id was started in.
+func (f *inflight) api(id string) *atomic.Pointer[clients] {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.apis[id]
+}
+
+func (f *inflight) contains(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.ids[id]
+	return ok
+}
+
+func (f *inflight) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]string, 0, len(f.ids))
+	for id := range f.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// queries returns the outstanding queries ordered by group.
+func (f *inflight) queries() []checkpointQuery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := make([]checkpointQuery, 0, len(f.ids))
+	for _, q := range f.ids {
+		queries = append(queries, q)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Group < queries[j].Group })
+	return queries
+}
+
+// take moves the outstanding queries of other into f, along with the
+// clients needed to stop them.
+func (f *inflight) take(other *inflight) {
+	for _, q := range other.queries() {
+		api := other.api(q.ID)
+		other.remove(q.ID)
+		f.mu.Lock()
+		f.ids[q.ID] = q
+		f.apis[q.ID] = api
+		f.mu.Unlock()
+	}
+}
+
+// Stop cancels a running query, through the region it was started in.
+func (l Logs) Stop(queryID string) error {
+	client := l.client()
+	if api := l.inflight.api(queryID); api != nil {
+		client = api.Load().logs
+	}
+	_, err := client.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: aws.String(queryID)})
+	l.inflight.remove(queryID)
+	return err
+}
+
+// StopAll cancels every query that is still outstanding.
+func (l Logs) StopAll() {
+	for _, id := range l.inflight.list() {
+		if err := l.Stop(id); err != nil {
+			l.logger.Warn("stop query", zap.String("id", id), zap.Error(err))
+			continue
+		}
+		l.logger.Info("stopped query", zap.String("id", id))
+	}
+}
+
+// Fatal stops all outstanding queries before logging msg and exiting, so
+// abandoned queries don't keep scanning (and billing) server-side.
+func (l Logs) Fatal(msg string, fields ...zap.Field) {
+	l.StopAll()
+	stdout.Flush()
+	l.logger.Fatal(msg, fields...)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestInflightTakeKeepsRegionClients(t *testing.T) {
+	a, b := &atomic.Pointer[clients]{}, &atomic.Pointer[clients]{}
+	first, second := newInflight(), newInflight()
+	first.add("q-a", "/a", a)
+	second.add("q-b", "/b", b)
+
+	first.take(second)
+	if got := first.api("q-a"); got != a {
+		t.Errorf("api(q-a) = %p, want %p", got, a)
+	}
+	if got := first.api("q-b"); got != b {
+		t.Errorf("api(q-b) = %p, want the region it was started in (%p)", got, b)
+	}
+	if len(second.list()) != 0 || second.api("q-b") != nil {
+		t.Error("take left queries behind in the source")
+	}
+	first.remove("q-b")
+	if first.api("q-b") != nil {
+		t.Error("remove kept the clients of q-b")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Level is a log severity, ordered from least to most severe.
+type Level int
+
+const (
+	LevelUnknown Level = iota
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[string]Level{
+	"trace":    LevelTrace,
+	"debug":    LevelDebug,
+	"info":     LevelInfo,
+	"notice":   LevelInfo,
+	"warn":     LevelWarn,
+	"warning":  LevelWarn,
+	"error":    LevelError,
+	"err":      LevelError,
+	"fatal":    LevelFatal,
+	"panic":    LevelFatal,
+	"crit":     LevelFatal,
+	"critical": LevelFatal,
+	"alert":    LevelFatal,
+	"emerg":    LevelFatal,
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	}
+	return ""
+}
+
+// syslogSeverity maps RFC 5424 severities 0-7 to levels.
+var syslogSeverity = [8]Level{LevelFatal, LevelFatal, LevelFatal, LevelError, LevelWarn, LevelInfo, LevelInfo, LevelDebug}
+
+var (
+	syslogPrefix  = regexp.MustCompile(`^<(\d{1,3})>`)
+	bracketLevel  = regexp.MustCompile(`\[([A-Za-z]+)\]`)
+	bareLevel     = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|PANIC|CRIT|CRITICAL)\b`)
+	jsonLevelKeys = []string{"level", "severity", "lvl", "log.level"}
+)
+
+// DetectLevel finds the level of msg from a JSON level field, a syslog
+// priority, a bracketed [LEVEL] or an upper-case level word, in that order.
+func DetectLevel(msg string) Level {
+	msg = strings.TrimSpace(msg)
+	if strings.HasPrefix(msg, "{") {
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(msg), &fields) == nil {
+			for _, key := range jsonLevelKeys {
+				switch v := fields[key].(type) {
+				case string:
+					if l, ok := levelNames[strings.ToLower(v)]; ok {
+						return l
+					}
+				case float64:
+					// bunyan/pino style numeric levels
+					switch {
+					case v >= 60:
+						return LevelFatal
+					case v >= 50:
+						return LevelError
+					case v >= 40:
+						return LevelWarn
+					case v >= 30:
+						return LevelInfo
+					case v >= 20:
+						return LevelDebug
+					case v > 0:
+						return LevelTrace
+					}
+				}
+			}
+		}
+	}
+	if m := syslogPrefix.FindStringSubmatch(msg); m != nil {
+		if pri, err := strconv.Atoi(m[1]); err == nil {
+			return syslogSeverity[pri%8]
+		}
+	}
+	for _, m := range bracketLevel.FindAllStringSubmatch(msg, -1) {
+		if l, ok := levelNames[strings.ToLower(m[1])]; ok {
+			return l
+		}
+	}
+	if m := bareLevel.FindString(msg); m != "" {
+		return levelNames[strings.ToLower(m)]
+	}
+	return LevelUnknown
+}
+
+// LevelFilter keeps records whose level is between Min and Max.
+type LevelFilter struct {
+	Min, Max Level
+}
+
+// ParseLevelFilter parses "warn" (exactly warn) or "warn+" (warn and above).
+func ParseLevelFilter(s string) (*LevelFilter, error) {
+	name := strings.ToLower(strings.TrimSuffix(s, "+"))
+	l, ok := levelNames[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown level %q", s)
+	}
+	f := &LevelFilter{Min: l, Max: l}
+	if strings.HasSuffix(s, "+") {
+		f.Max = LevelFatal
+	}
+	return f, nil
+}
+
+func (f *LevelFilter) Allows(l Level) bool {
+	return l >= f.Min && l <= f.Max
+}
+
+// InsightsClause returns a filter that narrows the search server-side to
+// messages that may have an allowed level. The clause looks for level words,
+// syslog priorities and numeric JSON levels without telling them apart, so
+// records are still checked client-side.
+func (f *LevelFilter) InsightsClause() string {
+	var words []string
+	for name, l := range levelNames {
+		if f.Allows(l) {
+			words = append(words, name)
+		}
+	}
+	sort.Strings(words)
+	keys := make([]string, len(jsonLevelKeys))
+	for i, k := range jsonLevelKeys {
+		keys[i] = regexp.QuoteMeta(k)
+	}
+	return fmt.Sprintf(` | filter @message like /(?i)(\b(%s)\b|^<\d+>|"(%s)"\s*:\s*\d)/`, strings.Join(words, "|"), strings.Join(keys, "|"))
+}
+
+// levelFilter is the filter selected with --level, if any.
+var levelFilter *LevelFilter
+
+func filterLevel(res []QueryResult) []QueryResult {
+	if levelFilter == nil {
+		return res
+	}
+	kept := res[:0]
+	for _, r := range res {
+		if levelFilter.Allows(DetectLevel(r.Message)) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
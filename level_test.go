@@ -0,0 +1,89 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDetectLevel(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want Level
+	}{
+		{`{"level":"warn","msg":"slow"}`, LevelWarn},
+		{`{"severity":"ERROR","message":"x"}`, LevelError},
+		{`{"level":50,"msg":"db down"}`, LevelError},
+		{`{"level":60,"msg":"exit"}`, LevelFatal},
+		{`{"level":30,"msg":"ok"}`, LevelInfo},
+		{`{"level":10}`, LevelTrace},
+		{"<11>Sep 22 00:00:00 host app: failed", LevelError},
+		{"<14>Sep 22 00:00:00 host app: started", LevelInfo},
+		{"2022-09-22 [warning] disk 91%", LevelWarn},
+		{"[main] [DEBUG] cache miss", LevelDebug},
+		{"2022-09-22 00:00:00 ERROR boom", LevelError},
+		{"CRITICAL: out of memory", LevelFatal},
+		{"an error occurred", LevelUnknown},
+		{"", LevelUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectLevel(tt.msg); got != tt.want {
+			t.Errorf("DetectLevel(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevelFilter(t *testing.T) {
+	tests := []struct {
+		s        string
+		min, max Level
+	}{
+		{"warn", LevelWarn, LevelWarn},
+		{"WARNING", LevelWarn, LevelWarn},
+		{"error+", LevelError, LevelFatal},
+		{"debug+", LevelDebug, LevelFatal},
+	}
+	for _, tt := range tests {
+		f, err := ParseLevelFilter(tt.s)
+		if err != nil {
+			t.Errorf("ParseLevelFilter(%q): %v", tt.s, err)
+			continue
+		}
+		if f.Min != tt.min || f.Max != tt.max {
+			t.Errorf("ParseLevelFilter(%q) = %v..%v, want %v..%v", tt.s, f.Min, f.Max, tt.min, tt.max)
+		}
+	}
+	for _, s := range []string{"loud", "+", ""} {
+		if _, err := ParseLevelFilter(s); err == nil {
+			t.Errorf("ParseLevelFilter(%q) succeeded, want error", s)
+		}
+	}
+}
+
+// The server-side clause must never drop a record the client-side check
+// would keep.
+func TestInsightsClauseKeepsDetectedLevels(t *testing.T) {
+	f, err := ParseLevelFilter("error+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clause := f.InsightsClause()
+	start, end := strings.Index(clause, "/"), strings.LastIndex(clause, "/")
+	re := regexp.MustCompile(clause[start+1 : end])
+
+	for _, msg := range []string{
+		`{"level":50,"msg":"db down"}`,
+		`{"level": 60}`,
+		`{"severity":"error"}`,
+		"<11>Sep 22 00:00:00 host app: failed",
+		"2022-09-22 [ERROR] boom",
+		"FATAL: exit",
+	} {
+		if f.Allows(DetectLevel(msg)) && !re.MatchString(msg) {
+			t.Errorf("clause %s filters out %q", clause, msg)
+		}
+	}
+	if re.MatchString("all good") {
+		t.Errorf("clause %s matches a message without a level", clause)
+	}
+}
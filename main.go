@@ -1,12 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/jessevdk/go-flags"
 	"go.uber.org/zap"
@@ -33,7 +44,7 @@ func NewLogger(logLevel zapcore.Level) *zap.Logger {
 			EncodeDuration: zapcore.StringDurationEncoder,
 			EncodeCaller:   zapcore.ShortCallerEncoder,
 		},
-		OutputPaths:      []string{"stdout"},
+		OutputPaths:      []string{"stderr"},
 		ErrorOutputPaths: []string{"stderr"},
 	}
 	logger, _ := myConfig.Build()
@@ -49,24 +60,79 @@ type Logger interface {
 }
 
 type Logs struct {
-	client *cloudwatchlogs.CloudWatchLogs
-	logger *zap.Logger
+	api      *atomic.Pointer[clients]
+	logger   *zap.Logger
+	inflight *inflight
+	limiter  *limiter
+	auth     *reauthState
 }
 
 func New(session *session.Session) *Logs {
-	return &Logs{
-		client: cloudwatchlogs.New(session),
-		logger: NewLogger(zap.DebugLevel),
+	logger := NewLogger(zap.DebugLevel)
+	l := &Logs{
+		api:      &atomic.Pointer[clients]{},
+		logger:   logger,
+		inflight: newInflight(),
+		limiter:  newLimiter(opts.Parallel, logger),
+		auth:     &reauthState{},
 	}
+	l.setClients(session)
+	return l
 }
 
+// clients holds the service clients built from one session. They are
+// swapped as a unit when the credentials are refreshed.
+type clients struct {
+	logs    *cloudwatchlogs.CloudWatchLogs
+	metrics *cloudwatch.CloudWatch
+}
+
+// setClients replaces the clients with ones built from sess. Searches that
+// are already running pick them up on their next call.
+func (l Logs) setClients(sess *session.Session) {
+	c := &clients{logs: cloudwatchlogs.New(sess), metrics: cloudwatch.New(sess)}
+	l.limiter.instrument(&c.logs.Handlers)
+	l.api.Store(c)
+}
+
+func (l Logs) client() *cloudwatchlogs.CloudWatchLogs { return l.api.Load().logs }
+
+func (l Logs) metrics() *cloudwatch.CloudWatch { return l.api.Load().metrics }
+
 type options struct {
-	Region    string `short:"r" long:"region" description:"" required:"false" default:"ap-northeast-1"`
-	Profile   string `short:"p" long:"profile" description:"" required:"false"`
-	GroupName string `short:"g" default:"/"`
-	Start     string `long:"start" default:"2022-09-22T00:00:00+09:00"`
-	End       string `long:"end" default:"2022-09-22T00:30:00+09:00"`
-	KeyWord   string `long:"keyword"`
+	Region    string        `short:"r" long:"region" description:"AWS region; defaults to the region of the environment or profile, then ap-northeast-1" required:"false"`
+	Profile   string        `short:"p" long:"profile" description:"" required:"false"`
+	GroupName string        `short:"g" default:"/"`
+	Start     string        `long:"start" default:"2022-09-22T00:00:00+09:00"`
+	End       string        `long:"end" default:"2022-09-22T00:30:00+09:00"`
+	KeyWord   string        `long:"keyword"`
+	Retry     int           `long:"retry" description:"number of times to retry groups whose queries failed" default:"1"`
+	Parallel  int           `long:"concurrency" description:"most groups searched at once; the actual number adapts to throttling and latency" default:"10"`
+	FailOn    []string      `long:"fail-on" description:"condition that makes the run exit non-zero (repeatable)" choice:"any" choice:"all" choice:"empty" choice:"budget" default:"any"`
+	Budget    float64       `long:"scan-budget" description:"GB scanned above which --fail-on=budget triggers"`
+	Output    string        `short:"o" long:"output" description:"output format" choice:"text" choice:"json" choice:"ndjson" choice:"xlsx" choice:"markdown" default:"text"`
+	WithMeta  bool          `long:"with-metadata" description:"include query ID, status and statistics in json/ndjson/xlsx/markdown records"`
+	Truncate  int           `long:"truncate" description:"shorten messages in markdown output to this many characters"`
+	Engine    string        `long:"engine" description:"search engine; auto picks FilterLogEvents for small scans of simple filters" choice:"auto" choice:"insights" choice:"filter" default:"auto"`
+	FilterMax float64       `long:"filter-max-gb" description:"largest estimated scan in GB that auto sends to FilterLogEvents" default:"1"`
+	MaxScan   float64       `long:"max-scan-gb" description:"refuse runs estimated to scan more GB than this; 0 disables the check" default:"10"`
+	Force     bool          `long:"force" description:"run even when the estimated scan exceeds --max-scan-gb"`
+	Order     string        `long:"order" description:"order in which groups are searched; recent looks up the last event of every group first, most recent searched first" choice:"recent" choice:"name" default:"name"`
+	CacheTTL  time.Duration `long:"cache-ttl" description:"serve identical searches that completed within this long from the cache" default:"15m"`
+	NoCache   bool          `long:"no-cache" description:"always run a fresh search"`
+	Name      string        `long:"name" description:"name of the query, used to remember its runs"`
+	SinceLast bool          `long:"since-last-run" description:"start where the last successful run of --name ended"`
+	Config    string        `long:"config" description:"path of the JSON configuration file"`
+	Window    string        `long:"window" description:"only keep results inside this time-window policy from the config"`
+	MultiLine string        `long:"multiline-start" description:"regex matching the first line of a record; other lines are merged into the record before them"`
+	MultiGap  time.Duration `long:"multiline-gap" description:"largest gap between the lines of one record" default:"1s"`
+	GroupBy   string        `long:"group-by" description:"summarize results instead of listing them" choice:"fingerprint"`
+	Level     string        `long:"level" description:"only keep records of this level, or this level and above with a trailing + (e.g. warn+)"`
+	Color     string        `long:"color" description:"color text output by severity" choice:"auto" choice:"always" choice:"never" default:"auto"`
+	Emit      string        `long:"emit-metric" description:"publish the number of matches per group to this CloudWatch metric, as Namespace/MetricName"`
+	Sinks     []string      `long:"sink" description:"also send records to this sink plugin from the config (repeatable)"`
+	Transform string        `long:"transform" description:"expression run on every record to filter, enrich or rewrite it; @file reads it from a file"`
+	Context   string        `long:"context" description:"use the profile, region, group and output of this context from the config"`
 }
 
 func ParseTime(target string) (time.Time, error) {
@@ -84,16 +150,64 @@ func UnixMillisecond(target time.Time) int64 {
 
 var opts options
 
-func (l Logs) GetGroupAll() []string {
-	var sarr []string
-	allGroups := cloudwatchlogs.DescribeLogGroupsInput{
+// DescribeGroups returns the log groups named on the command line, or every
+// log group whose name starts with the -g prefix when none were.
+func (l Logs) DescribeGroups(ctx context.Context) ([]*cloudwatchlogs.LogGroup, error) {
+	if len(names) > 0 {
+		return l.describeNamed(ctx, names)
+	}
+	var groups []*cloudwatchlogs.LogGroup
+	input := cloudwatchlogs.DescribeLogGroupsInput{
 		LogGroupNamePrefix: aws.String(opts.GroupName),
 	}
-	v, err := l.client.DescribeLogGroups(&allGroups)
+	err := l.client().DescribeLogGroupsPagesWithContext(ctx, &input, func(out *cloudwatchlogs.DescribeLogGroupsOutput, last bool) bool {
+		groups = append(groups, out.LogGroups...)
+		return true
+	})
+	return groups, err
+}
+
+// describeNamed looks up each named group. Groups that can't be described are
+// still returned by name so searching them reports the real error.
+func (l Logs) describeNamed(ctx context.Context, names []string) ([]*cloudwatchlogs.LogGroup, error) {
+	groups := make([]*cloudwatchlogs.LogGroup, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		g := &cloudwatchlogs.LogGroup{LogGroupName: aws.String(name)}
+		out, err := l.client().DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(name),
+			Limit:              aws.Int64(1),
+		})
+		if err == nil && len(out.LogGroups) > 0 && aws.StringValue(out.LogGroups[0].LogGroupName) == name {
+			g = out.LogGroups[0]
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// groupNames returns the names of the groups DescribeGroups finds.
+func (l Logs) groupNames(ctx context.Context) ([]string, error) {
+	groups, err := l.DescribeGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, aws.StringValue(g.LogGroupName))
+	}
+	return names, nil
+}
+
+func (l Logs) GetGroupAll() []string {
+	var sarr []string
+	v, err := l.DescribeGroups(context.Background())
 	if err != nil {
 		return sarr
 	}
-	for _, k := range v.LogGroups {
+	for _, k := range v {
 		sarr = append(sarr, *k.LogGroupName)
 	}
 	l.logger.Debug("sarr", zap.Strings("sarr", sarr))
@@ -104,8 +218,7 @@ func (l Logs) AssembleQuery(keyword string) (string, error) {
 	return fmt.Sprintf("fields @timestamp, @message, @logStream | filter @message %v", keyword), nil
 }
 
-func (l Logs) DoQuery(logGroup, query string) (string, error) {
-	l.logger.Debug("query", zap.String("q", query))
+func (l Logs) DoQuery(ctx context.Context, logGroup, query string) (string, error) {
 	ParsedFrom, err := ParseTime(opts.Start)
 	if err != nil {
 		return "", err
@@ -116,47 +229,94 @@ func (l Logs) DoQuery(logGroup, query string) (string, error) {
 		return "", err
 	}
 
+	return l.StartQuery(ctx, logGroup, query, ParsedFrom, ParsedTo)
+}
+
+// StartQuery starts query against logGroup over [from, to] and returns its ID.
+func (l Logs) StartQuery(ctx context.Context, logGroup, query string, from, to time.Time) (string, error) {
+	l.logger.Debug("query", zap.String("q", query))
 	input := &cloudwatchlogs.StartQueryInput{
-		StartTime:    aws.Int64(UnixMillisecond(ParsedFrom)),
-		EndTime:      aws.Int64(UnixMillisecond(ParsedTo)),
+		StartTime:    aws.Int64(UnixMillisecond(from)),
+		EndTime:      aws.Int64(UnixMillisecond(to)),
 		LogGroupName: aws.String(logGroup),
 		QueryString:  aws.String(query),
 	}
 
-	out, err := l.client.StartQuery(input)
+	out, err := l.client().StartQueryWithContext(ctx, input)
 	if err != nil {
 		return "", err
 	}
+	l.inflight.add(aws.StringValue(out.QueryId), logGroup, l.api)
 
 	return aws.StringValue(out.QueryId), nil
 }
 
+// QueryFailedError is returned when a query reaches a terminal status other
+// than Complete.
+type QueryFailedError struct {
+	QueryID string
+	Status  string
+}
+
+func (e *QueryFailedError) Error() string {
+	return fmt.Sprintf("query %s finished with status %s", e.QueryID, e.Status)
+}
+
+// IsRetryable reports whether a group that failed with err is worth querying
+// again later in the run.
+func IsRetryable(err error) bool {
+	var qerr *QueryFailedError
+	if errors.As(err, &qerr) {
+		return true
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case "ThrottlingException", "LimitExceededException", "ServiceUnavailableException":
+			return true
+		}
+	}
+	return false
+}
+
 type QueryResult struct {
 	Timestamp string
 	LogStream string
 	Message   string
+	Fields    map[string]interface{} `json:",omitempty"`
 }
 
-func (l Logs) Result(query string, wait bool) ([]QueryResult, error) {
+func (l Logs) Result(ctx context.Context, query string, wait bool) ([]QueryResult, *cloudwatchlogs.QueryStatistics, error) {
 
 	input := &cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(query)}
 
-	out, err := l.client.GetQueryResults(input)
+	out, err := l.client().GetQueryResultsWithContext(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if wait {
 		for {
-			if *out.Status == "Complete" {
+			status := aws.StringValue(out.Status)
+			if status == cloudwatchlogs.QueryStatusComplete {
+				l.inflight.remove(query)
 				break
 			}
-			out, err = l.client.GetQueryResults(input)
+			switch status {
+			case cloudwatchlogs.QueryStatusFailed, cloudwatchlogs.QueryStatusCancelled, cloudwatchlogs.QueryStatusTimeout:
+				l.inflight.remove(query)
+				return nil, nil, &QueryFailedError{QueryID: query, Status: status}
+			}
+			out, err = l.client().GetQueryResultsWithContext(ctx, input)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			l.logger.Debug("wait")
-			time.Sleep(time.Second * 10)
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(time.Second * 10):
+			}
 		}
 	}
 
@@ -181,7 +341,7 @@ func (l Logs) Result(query string, wait bool) ([]QueryResult, error) {
 
 	}
 
-	return result, nil
+	return result, out.Statistics, nil
 
 }
 
@@ -190,43 +350,503 @@ func getGroupAll(l Logger) []string {
 }
 
 func assembleQuery(l Logger) (string, error) {
-	return l.AssembleQuery(opts.KeyWord)
+	q, err := l.AssembleQuery(opts.KeyWord)
+	if err != nil {
+		return "", err
+	}
+	if levelFilter != nil {
+		q += levelFilter.InsightsClause()
+	}
+	return q, nil
 }
 
-func main() {
-	_, err := flags.ParseArgs(&opts, os.Args)
+// search runs query against the target group and waits for its results. If
+// the credentials expire along the way the user is asked to refresh them, and
+// a query that was already started is resumed by its ID rather than
+// restarted.
+//
+// Results of an identical search that completed within --cache-ttl are
+// served from the cache instead.
+func search(ctx context.Context, l *Logs, t Target, query string) ([]QueryResult, *QueryMeta, error) {
+	useCache := cacheable()
+	key := cacheKey(t, query)
+	if useCache {
+		if e, ok := loadCache(key, opts.CacheTTL); ok {
+			l.logger.Debug("cache hit", zap.String("group", t.Group), zap.Time("created", e.Created))
+			e.Meta.Cached = true
+			return e.Results, e.Meta, nil
+		}
+	}
+
+	var res []QueryResult
+	var meta *QueryMeta
+	var err error
+	if t.Engine == engineFilter {
+		res, meta, err = filterSearch(ctx, l, t)
+	} else {
+		res, meta, err = resume(ctx, l, t.Group, query, "")
+	}
+	if err == nil {
+		res = continuations(ctx, l, t.Group, res)
+	}
+	if err == nil && useCache {
+		if cerr := storeCache(key, &cacheEntry{Created: time.Now(), Meta: meta, Results: res}); cerr != nil {
+			l.logger.Debug("cache store", zap.Error(cerr))
+		}
+	}
+	return res, meta, err
+}
+
+// resume waits for the results of the query with the given id, starting it
+// first when id is empty.
+func resume(ctx context.Context, l *Logs, logGroup, query, id string) ([]QueryResult, *QueryMeta, error) {
+	for {
+		var err error
+		if id == "" {
+			id, err = l.DoQuery(ctx, logGroup, query)
+		}
+		if err == nil {
+			res, stats, rerr := l.Result(ctx, id, true)
+			if rerr == nil {
+				meta := &QueryMeta{ID: id, Group: logGroup, Engine: engineInsights, Status: cloudwatchlogs.QueryStatusComplete}
+				if stats != nil {
+					meta.Statistics = &QueryStatistics{
+						BytesScanned:   aws.Float64Value(stats.BytesScanned),
+						RecordsMatched: aws.Float64Value(stats.RecordsMatched),
+						RecordsScanned: aws.Float64Value(stats.RecordsScanned),
+					}
+				}
+				return res, meta, nil
+			}
+			err = rerr
+		}
+		if ctx.Err() != nil {
+			// Left running so the checkpoint can point results at it.
+			return nil, nil, err
+		}
+		if !IsExpiredCredentials(err) {
+			l.abandon(id)
+			return nil, nil, err
+		}
+		if rerr := l.Reauth(ctx, err); rerr != nil {
+			l.abandon(id)
+			return nil, nil, rerr
+		}
+	}
+}
+
+// abandon stops a query that was started but whose results will never be
+// read.
+func (l *Logs) abandon(id string) {
+	if !l.inflight.contains(id) {
+		return
+	}
+	if err := l.Stop(id); err != nil {
+		l.logger.Debug("stop query", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// stdout buffers result output; it must be flushed before exiting.
+var stdout = bufio.NewWriter(os.Stdout)
+
+// GroupFailure records a log group whose query could not be completed.
+type GroupFailure struct {
+	Group string
+	Err   error
+}
+
+// Summary describes the outcome of a run across all log groups.
+type Summary struct {
+	Succeeded    []string
+	Failed       []GroupFailure
+	Skipped      []string
+	Matches      int
+	GroupMatches map[string]int
+	BytesScanned float64
+}
+
+// Exit codes returned for each --fail-on condition.
+const (
+	exitGroupFailure = 1
+	exitNoMatch      = 2
+	exitBudget       = 3
+	exitInterrupted  = 130
+)
+
+// ExitCode returns the process exit code for the given --fail-on policy, or 0
+// when none of its conditions hold.
+func (s *Summary) ExitCode(failOn []string, budgetGB float64) int {
+	if len(s.Skipped) > 0 {
+		return exitInterrupted
+	}
+	for _, cond := range failOn {
+		switch cond {
+		case "any":
+			if len(s.Failed) > 0 {
+				return exitGroupFailure
+			}
+		case "all":
+			if len(s.Failed) > 0 && len(s.Succeeded) == 0 {
+				return exitGroupFailure
+			}
+		case "empty":
+			if s.Matches == 0 {
+				return exitNoMatch
+			}
+		case "budget":
+			if budgetGB > 0 && s.BytesScanned > budgetGB*(1<<30) {
+				return exitBudget
+			}
+		}
+	}
+	return 0
+}
+
+// merge adds the totals of o, a run in region, naming its groups
+// region:group.
+func (s *Summary) merge(o *Summary, region string) {
+	for _, g := range o.Succeeded {
+		s.Succeeded = append(s.Succeeded, region+":"+g)
+	}
+	for _, f := range o.Failed {
+		s.Failed = append(s.Failed, GroupFailure{Group: region + ":" + f.Group, Err: f.Err})
+	}
+	for _, g := range o.Skipped {
+		s.Skipped = append(s.Skipped, region+":"+g)
+	}
+	for g, n := range o.GroupMatches {
+		if s.GroupMatches == nil {
+			s.GroupMatches = make(map[string]int)
+		}
+		s.GroupMatches[region+":"+g] += n
+	}
+	s.Matches += o.Matches
+	s.BytesScanned += o.BytesScanned
+}
+
+// skipRegions reports the groups of regions as skipped. Their groups were
+// never listed, so they are named by the selection instead.
+func (s *Summary) skipRegions(regions []string) {
+	for _, region := range regions {
+		if len(names) == 0 {
+			s.Skipped = append(s.Skipped, region+":"+opts.GroupName+"*")
+			continue
+		}
+		for _, name := range names {
+			s.Skipped = append(s.Skipped, region+":"+name)
+		}
+	}
+}
+
+func (s *Summary) Report(w io.Writer) {
+	fmt.Fprintf(w, "%d groups succeeded, %d failed, %d matches, %.0f bytes scanned\n", len(s.Succeeded), len(s.Failed), s.Matches, s.BytesScanned)
+	for _, f := range s.Failed {
+		fmt.Fprintf(w, "  %s: %v\n", f.Group, f.Err)
+	}
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(w, "interrupted, %d groups not queried\n", len(s.Skipped))
+	}
+}
+
+// process applies the client-side stages to the results of one query before
+// they are written. It fails only when the group's parser had to be killed.
+func process(ctx context.Context, l *Logs, meta *QueryMeta, res []QueryResult) ([]QueryResult, error) {
+	res, err := parseFields(ctx, meta.Group, res)
+	if _, stalled := err.(*parserTimeoutError); stalled {
+		return nil, err
+	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		l.logger.Warn("parse fields", zap.String("group", meta.Group), zap.Error(err))
+	}
+	res = filterLevel(res)
+	res = filterWindow(res)
+	res, err = applyTransform(meta.Group, res)
+	if err != nil {
+		l.logger.Warn("transform", zap.String("group", meta.Group), zap.Error(err))
 	}
+	return res, nil
+}
 
-	fmt.Println(opts.KeyWord)
+// record writes the results of a successful query and adds it to the
+// summary, or reports the group as failed when processing them did.
+func (s *Summary) record(ctx context.Context, l *Logs, meta *QueryMeta, res []QueryResult, out Formatter) {
+	res, err := process(ctx, l, meta, res)
+	if err != nil {
+		l.logger.Warn("process results", zap.String("group", meta.Group), zap.Error(err))
+		s.Failed = append(s.Failed, GroupFailure{Group: meta.Group, Err: err})
+		return
+	}
+	if err := out.Write(meta, res); err != nil {
+		l.logger.Error("write results", zap.String("group", meta.Group), zap.Error(err))
+	}
+	s.Succeeded = append(s.Succeeded, meta.Group)
+	s.Matches += len(res)
+	if s.GroupMatches == nil {
+		s.GroupMatches = make(map[string]int)
+	}
+	s.GroupMatches[meta.Group] += len(res)
+	if meta.Statistics != nil && !meta.Cached {
+		s.BytesScanned += meta.Statistics.BytesScanned
+	}
+}
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Profile:           opts.Profile,
-		SharedConfigState: session.SharedConfigEnable,
-		Config: aws.Config{
-			Region: aws.String(opts.Region),
-		},
-	}))
+// run queries every group, retrying retryable failures at the end, and
+// keeps going past groups that fail so the others still produce results.
+// Groups are searched concurrently, as many at once as l.limiter allows.
+// Once ctx is cancelled no new queries are started and the remaining groups
+// are reported as skipped.
+func run(ctx context.Context, l *Logs, targets []Target, query string, out Formatter) *Summary {
+	summary := &Summary{}
+	var failed []GroupFailure
+	var mu sync.Mutex
+	byGroup := make(map[string]Target, len(targets))
+	skip := func(t Target) {
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Skipped = append(summary.Skipped, t.Group)
+	}
+	searchGroup := func(t Target) {
+		res, meta, err := search(ctx, l, t, query)
+		if ctx.Err() != nil {
+			skip(t)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			l.logger.Warn("query failed", zap.String("group", t.Group), zap.Error(err))
+			failed = append(failed, GroupFailure{Group: t.Group, Err: err})
+			return
+		}
+		summary.record(ctx, l, meta, res, out)
+	}
 
-	cloudwatch := New(sess)
-	q, err := assembleQuery(cloudwatch)
+	for _, t := range targets {
+		byGroup[t.Group] = t
+	}
+	l.limiter.fanOut(ctx, targets, searchGroup, skip)
+
+	for attempt := 1; attempt <= opts.Retry; attempt++ {
+		var retry []Target
+		for _, f := range failed {
+			if IsRetryable(f.Err) {
+				l.logger.Info("retry", zap.String("group", f.Group), zap.Int("attempt", attempt))
+				retry = append(retry, byGroup[f.Group])
+			} else {
+				summary.Failed = append(summary.Failed, f)
+			}
+		}
+		failed = nil
+		l.limiter.fanOut(ctx, retry, searchGroup, skip)
+	}
+	summary.Failed = append(summary.Failed, failed...)
+
+	return summary
+}
+
+// runSearch queries every matching group and writes the results in the
+// --output format. When the context names several regions, the groups of
+// each region are searched in turn into the same output.
+func runSearch(ctx context.Context, l *Logs) (*Summary, error) {
+	l.logger.Debug("search", zap.String("keyword", opts.KeyWord))
+
+	q, err := assembleQuery(l)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newOutput()
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			l.logger.Error("output", zap.Error(err))
+		}
+	}()
+	if len(moreRegions) == 0 {
+		return searchRegion(ctx, l, q, out)
 	}
-	for _, v := range getGroupAll(cloudwatch) {
-		t, err := cloudwatch.DoQuery(v, q)
+
+	first := opts.Region
+	defer func() { opts.Region = first }()
+	summary := &Summary{}
+	regions := append([]string{first}, moreRegions...)
+	for i, region := range regions {
+		if ctx.Err() != nil {
+			summary.skipRegions(regions[i:])
+			break
+		}
+		rl := l
+		if region != first {
+			opts.Region = region
+			sess, err := newSession()
+			if err != nil {
+				return summary, err
+			}
+			rl = New(sess)
+		}
+		s, err := searchRegion(ctx, rl, q, regionFormatter{out, region})
+		if rl != l {
+			l.inflight.take(rl.inflight)
+		}
+		if err != nil && ctx.Err() != nil {
+			summary.skipRegions(regions[i:])
+			break
+		}
 		if err != nil {
-			fmt.Println(err)
+			return summary, fmt.Errorf("%s: %w", region, err)
+		}
+		summary.merge(s, region)
+	}
+	return summary, nil
+}
+
+func searchRegion(ctx context.Context, l *Logs, query string, out Formatter) (*Summary, error) {
+	targets, err := l.PlanTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckScanSize(targets); err != nil {
+		return nil, err
+	}
+	return run(ctx, l, targets, query, out), nil
+}
+
+// setup loads the config and applies and compiles the options that depend on
+// it.
+func setup(parser *flags.Parser) error {
+	configPath := opts.Config
+	if configPath == "" {
+		configPath = defaultConfigPath()
+	}
+	var err error
+	conf, err = loadConfig(configPath, opts.Config != "")
+	if err != nil {
+		return err
+	}
+	// The context commands must keep working when the saved context is
+	// broken, since they are how it gets fixed.
+	if parser.Active == nil || parser.Active.Name != "context" {
+		if err := applyContext(parser); err != nil {
+			return err
+		}
+	}
+	if err := selectWindow(opts.Window); err != nil {
+		return err
+	}
+	if opts.Level != "" {
+		if levelFilter, err = ParseLevelFilter(opts.Level); err != nil {
+			return err
+		}
+	}
+	if opts.Transform != "" {
+		if transform, err = compileTransform(opts.Transform); err != nil {
+			return err
+		}
+	}
+	if opts.MultiLine != "" {
+		if recordStart, err = regexp.Compile(opts.MultiLine); err != nil {
+			return err
+		}
+	}
+	if opts.Emit != "" {
+		if _, _, err := splitMetricName(opts.Emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	addCommands(parser)
+	args, err := parser.ParseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := readArgs(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := setup(parser); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if parser.Active != nil && parser.Active.Name == "context" {
+		if err := runContext(parser.Active); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		res, err := cloudwatch.Result(t, true)
+		return
+	}
+
+	sess := session.Must(newSession())
+	opts.Region = aws.StringValue(sess.Config.Region)
+	cloudwatch := New(sess)
+
+	if opts.SinceLast {
+		if err := applySinceLastRun(parser.FindOptionByLongName("start").IsSet(), parser.FindOptionByLongName("end").IsSet()); err != nil {
+			cloudwatch.Fatal("since last run", zap.Error(err))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	var summary *Summary
+	if parser.Active != nil {
+		summary, err = runCommand(ctx, parser.Active, cloudwatch)
+		if err != nil {
+			cloudwatch.Fatal(parser.Active.Name, zap.Error(err))
+		}
+	} else {
+		summary, err = runSearch(ctx, cloudwatch)
 		if err != nil {
-			cloudwatch.logger.Fatal("fatal")
+			cloudwatch.Fatal("search", zap.Error(err))
+		}
+	}
+
+	if ctx.Err() != nil {
+		cloudwatch.logger.Warn("shutting down")
+		// An interrupted search leaves its running queries to finish and
+		// records them, with the groups it never reached, so the work can
+		// be picked up again. Other commands just stop theirs.
+		if parser.Active == nil && summary != nil {
+			if path, err := writeCheckpoint(cloudwatch.inflight.queries(), summary); err != nil {
+				cloudwatch.logger.Error("write checkpoint", zap.Error(err))
+				cloudwatch.StopAll()
+			} else {
+				fmt.Fprintf(os.Stderr, "checkpoint written to %s; fetch the running queries with `results --checkpoint`\n", path)
+			}
+		} else {
+			cloudwatch.StopAll()
+		}
+	}
+	if err := closeParsers(); err != nil {
+		cloudwatch.logger.Warn("close parsers", zap.Error(err))
+	}
+	stdout.Flush()
+	cloudwatch.logger.Sync()
+	if summary == nil {
+		return
+	}
+	summary.Report(os.Stderr)
+	// Counts from an interrupted run are partial and would read as a drop
+	// in matches, so they are not published.
+	if opts.Emit != "" {
+		if ctx.Err() != nil || len(summary.Skipped) > 0 {
+			cloudwatch.logger.Warn("run interrupted, not emitting metric", zap.String("metric", opts.Emit))
+		} else if err := cloudwatch.EmitMatches(opts.Emit, summary); err != nil {
+			cloudwatch.logger.Error("emit metric", zap.Error(err))
 		}
-		for _, r := range res {
-			fmt.Println(r.Message)
+	}
+	if opts.Name != "" && len(summary.Failed) == 0 && len(summary.Skipped) == 0 {
+		if err := recordRun(); err != nil {
+			cloudwatch.logger.Error("record run", zap.Error(err))
 		}
 	}
+	os.Exit(summary.ExitCode(opts.FailOn, opts.Budget))
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSummaryExitCode(t *testing.T) {
+	failure := []GroupFailure{{Group: "/b", Err: errors.New("AccessDenied")}}
+	tests := []struct {
+		name     string
+		summary  Summary
+		failOn   []string
+		budgetGB float64
+		want     int
+	}{
+		{"clean run", Summary{Succeeded: []string{"/a"}, Matches: 3}, []string{"any"}, 0, 0},
+		{"any with one failure", Summary{Succeeded: []string{"/a"}, Failed: failure, Matches: 3}, []string{"any"}, 0, exitGroupFailure},
+		{"all with one failure", Summary{Succeeded: []string{"/a"}, Failed: failure, Matches: 3}, []string{"all"}, 0, 0},
+		{"all with every group failed", Summary{Failed: failure}, []string{"all"}, 0, exitGroupFailure},
+		{"empty without matches", Summary{Succeeded: []string{"/a"}}, []string{"empty"}, 0, exitNoMatch},
+		{"empty is off by default", Summary{Succeeded: []string{"/a"}}, []string{"any"}, 0, 0},
+		{"over budget", Summary{Succeeded: []string{"/a"}, Matches: 1, BytesScanned: 2 << 30}, []string{"budget"}, 1, exitBudget},
+		{"under budget", Summary{Succeeded: []string{"/a"}, Matches: 1, BytesScanned: 1 << 29}, []string{"budget"}, 1, 0},
+		{"budget needs a limit", Summary{Succeeded: []string{"/a"}, Matches: 1, BytesScanned: 2 << 30}, []string{"budget"}, 0, 0},
+		{"first condition wins", Summary{Failed: failure}, []string{"empty", "any"}, 0, exitNoMatch},
+		{"interrupted wins", Summary{Failed: failure, Skipped: []string{"/c"}}, []string{"any", "empty"}, 0, exitInterrupted},
+	}
+	for _, tt := range tests {
+		if got := tt.summary.ExitCode(tt.failOn, tt.budgetGB); got != tt.want {
+			t.Errorf("%s: ExitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSkipRegions(t *testing.T) {
+	savedOpts, savedNames := opts, names
+	defer func() { opts, names = savedOpts, savedNames }()
+	opts.GroupName = "/ecs/"
+
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{want: []string{"us-east-1:/ecs/*", "eu-west-1:/ecs/*"}},
+		{names: []string{"/a", "/b"}, want: []string{"us-east-1:/a", "us-east-1:/b", "eu-west-1:/a", "eu-west-1:/b"}},
+	}
+	for _, tt := range tests {
+		names = tt.names
+		var s Summary
+		s.skipRegions([]string{"us-east-1", "eu-west-1"})
+		if !reflect.DeepEqual(s.Skipped, tt.want) {
+			t.Errorf("names %q: Skipped = %q, want %q", tt.names, s.Skipped, tt.want)
+		}
+	}
+}
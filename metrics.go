@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+type metricsCommand struct {
+	Metrics []string      `long:"metric" description:"metric to show as Namespace/MetricName[:Stat][@Dim=Value,...], e.g. AWS/Lambda/Errors:Sum@FunctionName=api (repeatable)" required:"true"`
+	Buckets int           `long:"buckets" description:"number of time buckets" default:"30"`
+	Period  time.Duration `long:"period" description:"bucket width; overrides --buckets"`
+}
+
+var metricsOpts metricsCommand
+
+// MetricSpec identifies one metric statistic.
+type MetricSpec struct {
+	Namespace  string
+	Name       string
+	Stat       string
+	Dimensions map[string]string
+}
+
+func (m MetricSpec) String() string {
+	return m.Namespace + "/" + m.Name + ":" + m.Stat
+}
+
+// ParseMetricSpec parses Namespace/MetricName[:Stat][@Dim=Value,...]. The
+// namespace may itself contain slashes, as in AWS/Lambda.
+func ParseMetricSpec(s string) (MetricSpec, error) {
+	spec := MetricSpec{Stat: "Sum", Dimensions: map[string]string{}}
+	name, dims, _ := strings.Cut(s, "@")
+	if dims != "" {
+		for _, kv := range strings.Split(dims, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return spec, fmt.Errorf("metric %q: dimension %q must look like Name=Value", s, kv)
+			}
+			spec.Dimensions[k] = v
+		}
+	}
+	if n, stat, ok := strings.Cut(name, ":"); ok {
+		name, spec.Stat = n, stat
+	}
+	var err error
+	spec.Namespace, spec.Name, err = splitMetricName(name)
+	return spec, err
+}
+
+// splitMetricName splits Namespace/MetricName at the last slash.
+func splitMetricName(s string) (namespace, name string, err error) {
+	i := strings.LastIndex(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return "", "", fmt.Errorf("metric %q must look like Namespace/MetricName", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// putMetricBatch is the most datums sent in one PutMetricData call.
+const putMetricBatch = 20
+
+// EmitMatches publishes the number of matches in each group that was
+// searched successfully as metric, a Namespace/MetricName, with LogGroup and,
+// when --name is given, QueryName dimensions.
+func (l Logs) EmitMatches(metric string, s *Summary) error {
+	namespace, name, err := splitMetricName(metric)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var data []*cloudwatch.MetricDatum
+	for _, group := range s.Succeeded {
+		dims := []*cloudwatch.Dimension{{Name: aws.String("LogGroup"), Value: aws.String(group)}}
+		if opts.Name != "" {
+			dims = append(dims, &cloudwatch.Dimension{Name: aws.String("QueryName"), Value: aws.String(opts.Name)})
+		}
+		data = append(data, &cloudwatch.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dims,
+			Timestamp:  aws.Time(now),
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(float64(s.GroupMatches[group])),
+		})
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > putMetricBatch {
+			n = putMetricBatch
+		}
+		if _, err := l.metrics().PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(namespace),
+			MetricData: data[:n],
+		}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// MetricSeries fetches each metric over [from, to] in buckets of period and
+// returns one value per bucket for each.
+func (l Logs) MetricSeries(ctx context.Context, specs []MetricSpec, from, to time.Time, period time.Duration) ([][]float64, error) {
+	n := int(to.Sub(from) / period)
+	input := &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(from),
+		EndTime:   aws.Time(to),
+	}
+	for i, spec := range specs {
+		var dims []*cloudwatch.Dimension
+		for k, v := range spec.Dimensions {
+			dims = append(dims, &cloudwatch.Dimension{Name: aws.String(k), Value: aws.String(v)})
+		}
+		input.MetricDataQueries = append(input.MetricDataQueries, &cloudwatch.MetricDataQuery{
+			Id: aws.String(fmt.Sprintf("m%d", i)),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String(spec.Namespace),
+					MetricName: aws.String(spec.Name),
+					Dimensions: dims,
+				},
+				Period: aws.Int64(int64(period / time.Second)),
+				Stat:   aws.String(spec.Stat),
+			},
+		})
+	}
+
+	series := make([][]float64, len(specs))
+	for i := range series {
+		series[i] = make([]float64, n)
+	}
+	err := l.metrics().GetMetricDataPagesWithContext(ctx, input, func(out *cloudwatch.GetMetricDataOutput, last bool) bool {
+		for _, r := range out.MetricDataResults {
+			var i int
+			fmt.Sscanf(aws.StringValue(r.Id), "m%d", &i)
+			for j, ts := range r.Timestamps {
+				b := int(aws.TimeValue(ts).Sub(from) / period)
+				if b >= 0 && b < n && j < len(r.Values) {
+					series[i][b] = aws.Float64Value(r.Values[j])
+				}
+			}
+		}
+		return true
+	})
+	return series, err
+}
+
+// metricsPeriod picks the bucket width: --period, or the window split into
+// --buckets rounded up to whole minutes, the finest period most metrics keep.
+func metricsPeriod(from, to time.Time) time.Duration {
+	period := metricsOpts.Period
+	if period <= 0 {
+		buckets := metricsOpts.Buckets
+		if buckets <= 0 {
+			buckets = 30
+		}
+		period = to.Sub(from) / time.Duration(buckets)
+	}
+	if period < time.Minute {
+		period = time.Minute
+	}
+	return (period + time.Minute - 1).Truncate(time.Minute)
+}
+
+func runMetrics(ctx context.Context, l *Logs) (*Summary, error) {
+	var specs []MetricSpec
+	for _, s := range metricsOpts.Metrics {
+		spec, err := ParseMetricSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, err
+	}
+	period := metricsPeriod(from, to)
+	if to.Sub(from) < period {
+		return nil, fmt.Errorf("window %s is shorter than the period %s", to.Sub(from), period)
+	}
+
+	q, err := assembleQuery(l)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := l.PlanTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckScanSize(targets); err != nil {
+		return nil, err
+	}
+
+	records, summary := searchWindow(ctx, l, targets, q, from, to)
+	var times []time.Time
+	for _, r := range records {
+		if t, err := time.Parse(insightsTimeLayout, r.Timestamp); err == nil {
+			times = append(times, t)
+		}
+	}
+	n := int(to.Sub(from) / period)
+	logs := Histogram(times, from, from.Add(period*time.Duration(n)), n)
+
+	series, err := l.MetricSeries(ctx, specs, from, to, period)
+	if err != nil {
+		return summary, err
+	}
+
+	columns := []string{"LOG MATCHES"}
+	values := [][]float64{make([]float64, n)}
+	for i, c := range logs {
+		values[0][i] = float64(c)
+	}
+	for i, spec := range specs {
+		columns = append(columns, spec.String())
+		values = append(values, series[i])
+	}
+	return summary, printTimeline(stdout, from, period, columns, values)
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// spark returns a bar for v scaled against peak.
+func spark(v, peak float64) string {
+	if peak <= 0 || v <= 0 {
+		return " "
+	}
+	i := int(v / peak * float64(len(sparkBlocks)-1))
+	return string(sparkBlocks[i])
+}
+
+// printTimeline prints one row per bucket with a bar and value for each
+// column, each column scaled to its own peak.
+func printTimeline(w io.Writer, from time.Time, period time.Duration, columns []string, values [][]float64) error {
+	peaks := make([]float64, len(values))
+	for c, col := range values {
+		for _, v := range col {
+			if v > peaks[c] {
+				peaks[c] = v
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "TIME\t%s\n", strings.Join(columns, "\t"))
+	for i := range values[0] {
+		cells := make([]string, len(values))
+		for c := range values {
+			cells[c] = fmt.Sprintf("%s %g", spark(values[c][i], peaks[c]), values[c][i])
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", from.Add(period*time.Duration(i)).Format(time.RFC3339), strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetricSpec(t *testing.T) {
+	tests := []struct {
+		s    string
+		want MetricSpec
+	}{
+		{"AWS/Lambda/Errors", MetricSpec{Namespace: "AWS/Lambda", Name: "Errors", Stat: "Sum", Dimensions: map[string]string{}}},
+		{"Custom/Latency:p99", MetricSpec{Namespace: "Custom", Name: "Latency", Stat: "p99", Dimensions: map[string]string{}}},
+		{
+			"AWS/ApplicationELB/HTTPCode_Target_5XX_Count:Sum@LoadBalancer=app/web/123,TargetGroup=tg=1",
+			MetricSpec{Namespace: "AWS/ApplicationELB", Name: "HTTPCode_Target_5XX_Count", Stat: "Sum", Dimensions: map[string]string{"LoadBalancer": "app/web/123", "TargetGroup": "tg=1"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseMetricSpec(tt.s)
+		if err != nil {
+			t.Errorf("ParseMetricSpec(%q): %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMetricSpec(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+	for _, s := range []string{"Errors", "/Errors", "AWS/Lambda/", "AWS/Lambda/Errors@FunctionName", "AWS/Lambda/Errors@=api"} {
+		if _, err := ParseMetricSpec(s); err == nil {
+			t.Errorf("ParseMetricSpec(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestMetricsPeriod(t *testing.T) {
+	saved := metricsOpts
+	defer func() { metricsOpts = saved }()
+	from := time.Date(2022, 9, 22, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		window  time.Duration
+		buckets int
+		period  time.Duration
+		want    time.Duration
+	}{
+		{time.Hour, 30, 0, 2 * time.Minute},
+		{time.Hour, 7, 0, 9 * time.Minute},
+		{10 * time.Minute, 30, 0, time.Minute},
+		{time.Hour, 30, 90 * time.Second, 2 * time.Minute},
+		{time.Hour, 0, 0, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		metricsOpts.Buckets, metricsOpts.Period = tt.buckets, tt.period
+		if got := metricsPeriod(from, from.Add(tt.window)); got != tt.want {
+			t.Errorf("metricsPeriod(%s, buckets %d, period %s) = %s, want %s", tt.window, tt.buckets, tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestPrintTimeline(t *testing.T) {
+	from := time.Date(2022, 9, 22, 0, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	err := printTimeline(&b, from, time.Minute, []string{"LOG MATCHES", "AWS/Lambda/Errors:Sum"}, [][]float64{{0, 4, 8}, {1, 1, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want a header and 3 rows:\n%s", len(lines), b.String())
+	}
+	if !strings.HasPrefix(lines[3], "2022-09-22T00:02:00Z") || !strings.Contains(lines[3], "█ 8") {
+		t.Errorf("peak row = %q", lines[3])
+	}
+	if !strings.Contains(lines[1], "█ 1") {
+		t.Errorf("each column should scale to its own peak: %q", lines[1])
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordStart is the compiled --multiline-start pattern, nil when
+// reassembly is off.
+var recordStart *regexp.Regexp
+
+// maxContinuationFetches bounds how many times the window around a match is
+// widened to follow a record that keeps going.
+const maxContinuationFetches = 20
+
+// maxContinuationSpans bounds how many windows around matches are fetched
+// for one group. The matches past it are reassembled among themselves.
+const maxContinuationSpans = 50
+
+// Reassemble merges events that continue a record, such as the lines of a
+// stack trace logged as separate events, back into the event that started
+// it. An event continues the previous one in the same stream when it doesn't
+// match start and follows it within gap. Records keep the position of their
+// first event.
+func Reassemble(res []QueryResult, start *regexp.Regexp, gap time.Duration) []QueryResult {
+	return reassemble(res, nil, start, gap)
+}
+
+// reassemble is Reassemble, keeping only the records that contain an event
+// marked in matched when matched is not nil.
+func reassemble(res []QueryResult, matched []bool, start *regexp.Regexp, gap time.Duration) []QueryResult {
+	if start == nil || len(res) < 2 && matched == nil {
+		return res
+	}
+
+	type event struct {
+		index   int
+		at      time.Time
+		matched bool
+		QueryResult
+	}
+	events := make([]event, len(res))
+	for i, r := range res {
+		at, _ := time.Parse(insightsTimeLayout, r.Timestamp)
+		events[i] = event{index: i, at: at, matched: matched == nil || matched[i], QueryResult: r}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].LogStream != events[j].LogStream {
+			return events[i].LogStream < events[j].LogStream
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	var merged []event
+	for _, e := range events {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			if prev.LogStream == e.LogStream && !start.MatchString(e.Message) && e.at.Sub(prev.at) <= gap {
+				prev.Message += "\n" + e.Message
+				prev.at = e.at
+				prev.matched = prev.matched || e.matched
+				continue
+			}
+		}
+		merged = append(merged, e)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].index < merged[j].index })
+	out := make([]QueryResult, 0, len(merged))
+	for _, e := range merged {
+		if e.matched {
+			out = append(out, e.QueryResult)
+		}
+	}
+	return out
+}
+
+// withContinuations rebuilds the records that the matches in res belong to.
+// The query only returns the events that matched, and the other lines of a
+// stack trace rarely match the keyword, so the events around each match are
+// fetched from its stream and reassembled with it. Only records containing a
+// match are kept.
+func (l Logs) withContinuations(ctx context.Context, group string, res []QueryResult) ([]QueryResult, error) {
+	if recordStart == nil || len(res) == 0 {
+		return res, nil
+	}
+
+	var streams []string
+	times := make(map[string][]time.Time)
+	matches := make(map[string]bool, len(res))
+	for _, r := range res {
+		at, err := time.Parse(insightsTimeLayout, r.Timestamp)
+		if err != nil || r.LogStream == "" {
+			continue
+		}
+		if _, ok := times[r.LogStream]; !ok {
+			streams = append(streams, r.LogStream)
+		}
+		times[r.LogStream] = append(times[r.LogStream], at)
+		matches[eventKey(r)] = true
+	}
+
+	var events []QueryResult
+	var matched []bool
+	seen := make(map[string]bool)
+	add := func(r QueryResult) {
+		if k := eventKey(r); !seen[k] {
+			seen[k] = true
+			events = append(events, r)
+			matched = append(matched, matches[k])
+		}
+	}
+	fetched, skipped := 0, 0
+	for _, stream := range streams {
+		for _, span := range matchSpans(times[stream], opts.MultiGap) {
+			if fetched == maxContinuationSpans {
+				skipped++
+				continue
+			}
+			fetched++
+			found, err := l.followRecord(ctx, group, stream, span[0], span[1], opts.MultiGap)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range found {
+				add(r)
+			}
+		}
+	}
+	if skipped > 0 {
+		l.logger.Warn("too many matches to fetch continuations for, reassembling the rest from the matches alone",
+			zap.String("group", group), zap.Int("fetched", fetched), zap.Int("skipped", skipped))
+	}
+	// Keep matches the stream didn't return, e.g. ones without a stream or
+	// past maxContinuationSpans.
+	for _, r := range res {
+		add(r)
+	}
+	return reassemble(events, matched, recordStart, opts.MultiGap), nil
+}
+
+// continuations is withContinuations for a group's results, falling back to
+// reassembling the matches alone when the neighbours can't be fetched.
+func continuations(ctx context.Context, l *Logs, group string, res []QueryResult) []QueryResult {
+	out, err := l.withContinuations(ctx, group, res)
+	if err != nil {
+		l.logger.Warn("fetch continuations", zap.String("group", group), zap.Error(err))
+		return Reassemble(res, recordStart, opts.MultiGap)
+	}
+	return out
+}
+
+func eventKey(r QueryResult) string {
+	return r.LogStream + "\x00" + r.Timestamp + "\x00" + r.Message
+}
+
+// matchSpans returns the windows of gap around each time, merged where they
+// overlap.
+func matchSpans(times []time.Time, gap time.Duration) [][2]time.Time {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	var spans [][2]time.Time
+	for _, t := range times {
+		from, to := t.Add(-gap), t.Add(gap)
+		if n := len(spans); n > 0 && !from.After(spans[n-1][1]) {
+			spans[n-1][1] = to
+			continue
+		}
+		spans = append(spans, [2]time.Time{from, to})
+	}
+	return spans
+}
+
+// followRecord returns the events of stream in [from, to], widening the
+// window by gap at either end for as long as events keep arriving within gap
+// of its edge.
+func (l Logs) followRecord(ctx context.Context, group, stream string, from, to time.Time, gap time.Duration) ([]QueryResult, error) {
+	events, err := l.StreamEvents(ctx, group, stream, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxContinuationFetches && len(events) > 0; i++ {
+		first, _ := time.Parse(insightsTimeLayout, events[0].Timestamp)
+		last, _ := time.Parse(insightsTimeLayout, events[len(events)-1].Timestamp)
+		grew := false
+		if first.Add(-gap).Before(from) {
+			before, err := l.StreamEvents(ctx, group, stream, first.Add(-gap), from.Add(-time.Millisecond))
+			if err != nil {
+				return nil, err
+			}
+			from = first.Add(-gap)
+			if len(before) > 0 {
+				events = append(before, events...)
+				grew = true
+			}
+		}
+		if last.Add(gap).After(to) {
+			after, err := l.StreamEvents(ctx, group, stream, to.Add(time.Millisecond), last.Add(gap))
+			if err != nil {
+				return nil, err
+			}
+			to = last.Add(gap)
+			if len(after) > 0 {
+				events = append(events, after...)
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+	return events, nil
+}
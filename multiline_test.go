@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var testBase = time.Date(2022, 9, 22, 0, 0, 0, 0, time.UTC)
+
+// at formats the time ms milliseconds after testBase like Insights does.
+func at(ms int) string {
+	return testBase.Add(time.Duration(ms) * time.Millisecond).Format(insightsTimeLayout)
+}
+
+func messages(res []QueryResult) []string {
+	var out []string
+	for _, r := range res {
+		out = append(out, r.Message)
+	}
+	return out
+}
+
+func TestReassemble(t *testing.T) {
+	start := regexp.MustCompile(`^\d{4}-`)
+	res := []QueryResult{
+		{Timestamp: at(0), LogStream: "a", Message: "2022-09-22 ERROR boom"},
+		{Timestamp: at(5), LogStream: "b", Message: "2022-09-22 INFO other stream"},
+		{Timestamp: at(10), LogStream: "a", Message: "\tat Foo.bar"},
+		{Timestamp: at(20), LogStream: "b", Message: "\tat not after a"},
+		{Timestamp: at(900), LogStream: "a", Message: "\tat Foo.main"},
+		{Timestamp: at(5000), LogStream: "a", Message: "\tat too late"},
+		{Timestamp: at(5100), LogStream: "a", Message: "2022-09-22 INFO next"},
+	}
+	got := messages(Reassemble(res, start, time.Second))
+	want := []string{
+		"2022-09-22 ERROR boom\n\tat Foo.bar\n\tat Foo.main",
+		"2022-09-22 INFO other stream\n\tat not after a",
+		"\tat too late",
+		"2022-09-22 INFO next",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reassemble = %q, want %q", got, want)
+	}
+
+	if got := Reassemble(res, nil, time.Second); len(got) != len(res) {
+		t.Errorf("Reassemble without a start pattern merged records")
+	}
+}
+
+func TestReassembleMatched(t *testing.T) {
+	start := regexp.MustCompile(`^(ERROR|INFO)`)
+	res := []QueryResult{
+		{Timestamp: at(0), LogStream: "a", Message: "INFO ok"},
+		{Timestamp: at(100), LogStream: "a", Message: "ERROR boom"},
+		{Timestamp: at(200), LogStream: "a", Message: "\tat NullPointer"},
+	}
+	got := messages(reassemble(res, []bool{false, false, true}, start, time.Second))
+	want := []string{"ERROR boom\n\tat NullPointer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reassemble = %q, want %q", got, want)
+	}
+}
+
+func TestMatchSpans(t *testing.T) {
+	times := []time.Time{testBase.Add(5 * time.Second), testBase, testBase.Add(time.Second)}
+	got := matchSpans(times, time.Second)
+	want := [][2]time.Time{
+		{testBase.Add(-time.Second), testBase.Add(2 * time.Second)},
+		{testBase.Add(4 * time.Second), testBase.Add(6 * time.Second)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matchSpans = %v, want %v", got, want)
+	}
+}
+
+// A keyword usually matches only one line of a stack trace; the rest must be
+// fetched from the stream, following the record past the first window.
+func TestWithContinuations(t *testing.T) {
+	stream := []struct {
+		ms  int
+		msg string
+	}{
+		{0, "ERROR boom"}, {300, "\tat a"}, {900, "\tat b"}, {1700, "\tat c"},
+		{5000, "INFO ok"}, {5100, "\tat NullPointer"},
+		{9000, "INFO unrelated"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ StartTime, EndTime int64 }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Error(err)
+		}
+		events := []map[string]interface{}{}
+		for _, e := range stream {
+			ts := testBase.Add(time.Duration(e.ms) * time.Millisecond).UnixMilli()
+			if ts >= in.StartTime && ts <= in.EndTime {
+				events = append(events, map[string]interface{}{"timestamp": ts, "message": e.msg, "logStreamName": "s"})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+	}))
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	saved, savedStart := opts, recordStart
+	defer func() { opts, recordStart = saved, savedStart }()
+	recordStart = regexp.MustCompile(`^(ERROR|INFO)`)
+	opts.MultiGap = time.Second
+
+	l := New(sess)
+	res, err := l.withContinuations(context.Background(), "/app", []QueryResult{
+		{Timestamp: at(0), LogStream: "s", Message: "ERROR boom"},
+		{Timestamp: at(5100), LogStream: "s", Message: "\tat NullPointer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := messages(res)
+	want := []string{"ERROR boom\n\tat a\n\tat b\n\tat c", "INFO ok\n\tat NullPointer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withContinuations = %q, want %q", got, want)
+	}
+}
+
+// Past maxContinuationSpans no more windows are fetched, but the remaining
+// matches are still returned.
+func TestWithContinuationsCap(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"events": []interface{}{}})
+	}))
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	saved, savedStart := opts, recordStart
+	defer func() { opts, recordStart = saved, savedStart }()
+	recordStart = regexp.MustCompile(`^ERROR`)
+	opts.MultiGap = time.Second
+
+	var res []QueryResult
+	for i := 0; i < maxContinuationSpans+5; i++ {
+		res = append(res, QueryResult{Timestamp: at(i * 10000), LogStream: "s", Message: "ERROR boom"})
+	}
+	got, err := New(sess).withContinuations(context.Background(), "/app", res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != maxContinuationSpans {
+		t.Errorf("FilterLogEvents called %d times, want %d", calls, maxContinuationSpans)
+	}
+	if len(got) != len(res) {
+		t.Errorf("got %d records, want %d", len(got), len(res))
+	}
+}
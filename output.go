@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// QueryMeta identifies the CloudWatch query a result came from.
+type QueryMeta struct {
+	ID         string           `json:"id"`
+	Group      string           `json:"group"`
+	Region     string           `json:"region,omitempty"`
+	Engine     string           `json:"engine"`
+	Status     string           `json:"status"`
+	Cached     bool             `json:"cached,omitempty"`
+	Statistics *QueryStatistics `json:"statistics,omitempty"`
+}
+
+type QueryStatistics struct {
+	BytesScanned   float64 `json:"bytesScanned"`
+	RecordsMatched float64 `json:"recordsMatched"`
+	RecordsScanned float64 `json:"recordsScanned"`
+}
+
+// Formatter writes the results of each query in one of the --output formats.
+type Formatter interface {
+	Write(meta *QueryMeta, res []QueryResult) error
+	Close() error
+}
+
+func NewFormatter(format string, w io.Writer, withMeta bool) (Formatter, error) {
+	if opts.GroupBy == "fingerprint" {
+		switch format {
+		case "text", "json", "ndjson":
+			return &fingerprintFormatter{collector: newCollector(withMeta), w: w, format: format}, nil
+		}
+		return nil, fmt.Errorf("--group-by fingerprint cannot be written as %s", format)
+	}
+	switch format {
+	case "text":
+		return &textFormatter{w: w, color: useColor()}, nil
+	case "json":
+		return &jsonFormatter{w: w, withMeta: withMeta}, nil
+	case "ndjson":
+		return &ndjsonFormatter{enc: json.NewEncoder(w), withMeta: withMeta}, nil
+	case "xlsx":
+		return newXLSXFormatter(w, withMeta), nil
+	case "markdown":
+		return &markdownFormatter{w: w, withMeta: withMeta, truncate: opts.Truncate}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+type record struct {
+	Timestamp string                 `json:"timestamp"`
+	LogStream string                 `json:"logStream"`
+	Message   string                 `json:"message"`
+	Level     string                 `json:"level,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Group     string                 `json:"group"`
+	Region    string                 `json:"region,omitempty"`
+	Query     *QueryMeta             `json:"query,omitempty"`
+}
+
+func newRecord(meta *QueryMeta, r QueryResult, withMeta bool) record {
+	rec := record{
+		Timestamp: r.Timestamp,
+		LogStream: r.LogStream,
+		Message:   r.Message,
+		Level:     DetectLevel(r.Message).String(),
+		Fields:    r.Fields,
+		Group:     meta.Group,
+		Region:    meta.Region,
+	}
+	if withMeta {
+		rec.Query = meta
+	}
+	return rec
+}
+
+// regionFormatter labels the results of a search that spans several
+// regions with the region they came from.
+type regionFormatter struct {
+	Formatter
+	region string
+}
+
+func (f regionFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	labeled := *meta
+	labeled.Region = f.region
+	return f.Formatter.Write(&labeled, res)
+}
+
+// collector buffers records and per-group totals for formats that can only
+// be written once the run is complete.
+type collector struct {
+	withMeta bool
+	records  []record
+	groups   []*QueryMeta
+	matches  map[string]int
+}
+
+func newCollector(withMeta bool) *collector {
+	return &collector{withMeta: withMeta, matches: make(map[string]int)}
+}
+
+func (c *collector) Write(meta *QueryMeta, res []QueryResult) error {
+	for _, r := range res {
+		c.records = append(c.records, newRecord(meta, r, c.withMeta))
+	}
+	if _, ok := c.matches[meta.Group]; !ok {
+		c.groups = append(c.groups, meta)
+	}
+	c.matches[meta.Group] += len(res)
+	return nil
+}
+
+func (c *collector) Close() error { return nil }
+
+type textFormatter struct {
+	w     io.Writer
+	color bool
+}
+
+func (f *textFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	for _, r := range res {
+		msg := r.Message
+		if f.color {
+			msg = colorize(msg, DetectLevel(msg))
+		}
+		if _, err := fmt.Fprintln(f.w, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// colorize paints every line of msg by level: red for error and fatal,
+// yellow for warn. Lines are colored separately so pagers that reset colors
+// at line breaks keep them.
+func colorize(msg string, level Level) string {
+	var color string
+	switch level {
+	case LevelError, LevelFatal:
+		color = ansiRed
+	case LevelWarn:
+		color = ansiYellow
+	default:
+		return msg
+	}
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		lines[i] = color + line + ansiReset
+	}
+	return strings.Join(lines, "\n")
+}
+
+// useColor applies --color; auto colors only when stdout is a terminal and
+// NO_COLOR is unset.
+func useColor() bool {
+	switch opts.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (f *textFormatter) Close() error { return nil }
+
+type ndjsonFormatter struct {
+	enc      *json.Encoder
+	withMeta bool
+}
+
+func (f *ndjsonFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	for _, r := range res {
+		if err := f.enc.Encode(newRecord(meta, r, f.withMeta)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *ndjsonFormatter) Close() error { return nil }
+
+// jsonFormatter streams a single JSON array so large runs don't have to be
+// held in memory.
+type jsonFormatter struct {
+	w        io.Writer
+	withMeta bool
+	n        int
+}
+
+func (f *jsonFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	for _, r := range res {
+		b, err := json.Marshal(newRecord(meta, r, f.withMeta))
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if f.n == 0 {
+			sep = "[\n"
+		}
+		if _, err := fmt.Fprintf(f.w, "%s%s", sep, b); err != nil {
+			return err
+		}
+		f.n++
+	}
+	return nil
+}
+
+func (f *jsonFormatter) Close() error {
+	if f.n == 0 {
+		_, err := fmt.Fprintln(f.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(f.w, "\n]")
+	return err
+}
+
+// markdownFormatter writes a GitHub-flavored table that can be pasted into
+// issues and postmortems as is.
+type markdownFormatter struct {
+	w        io.Writer
+	withMeta bool
+	truncate int
+	started  bool
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"|", "\\|",
+	"<", "&lt;",
+	">", "&gt;",
+	"`", "\\`",
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+func markdownCell(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func (f *markdownFormatter) header() error {
+	if f.started {
+		return nil
+	}
+	f.started = true
+	if f.withMeta {
+		_, err := fmt.Fprint(f.w, "| Timestamp | Group | Log Stream | Message | Query ID |\n|---|---|---|---|---|\n")
+		return err
+	}
+	_, err := fmt.Fprint(f.w, "| Timestamp | Group | Log Stream | Message |\n|---|---|---|---|\n")
+	return err
+}
+
+func (f *markdownFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	if err := f.header(); err != nil {
+		return err
+	}
+	for _, r := range res {
+		msg := markdownCell(truncate(strings.TrimRight(r.Message, "\r\n"), f.truncate, "…"))
+		row := fmt.Sprintf("| %s | %s | %s | %s |", markdownCell(r.Timestamp), markdownCell(meta.Group), markdownCell(r.LogStream), msg)
+		if f.withMeta {
+			row += fmt.Sprintf(" %s |", markdownCell(meta.ID))
+		}
+		if _, err := fmt.Fprintln(f.w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *markdownFormatter) Close() error {
+	return f.header()
+}
+
+// truncate shortens s to at most n characters, ending it with suffix when
+// anything was cut. n <= 0 means no limit.
+func truncate(s string, n int, suffix string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	keep := n - utf8.RuneCountInString(suffix)
+	if keep < 0 {
+		keep = 0
+	}
+	return string(r[:keep]) + suffix
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownCell(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"plain", "plain"},
+		{"a | b", `a \| b`},
+		{`C:\tmp`, `C:\\tmp`},
+		{"<script>", "&lt;script&gt;"},
+		{"use `code`", "use \\`code\\`"},
+		{"line1\nline2\r\nline3\rline4", "line1<br>line2<br>line3<br>line4"},
+	}
+	for _, tt := range tests {
+		if got := markdownCell(tt.s); got != tt.want {
+			t.Errorf("markdownCell(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 6, "hello…"},
+		{"日本語のログ", 4, "日本語…"},
+		{"hello", 1, "…"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n, "…"); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownFormatter(t *testing.T) {
+	var b bytes.Buffer
+	f := &markdownFormatter{w: &b}
+	meta := &QueryMeta{ID: "q1", Group: "/app"}
+	if err := f.Write(meta, []QueryResult{{Timestamp: "2022-09-22 00:00:00.000", LogStream: "s", Message: "a|b\n"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header, separator and one row:\n%s", len(lines), b.String())
+	}
+	if want := `| 2022-09-22 00:00:00.000 | /app | s | a\|b |`; lines[2] != want {
+		t.Errorf("row = %q, want %q", lines[2], want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"time"
+)
+
+// ParserConfig describes an exec parser plugin. The command is started once
+// per run and receives one JSON request per line on stdin:
+//
+//	{"message": "...", "group": "...", "logStream": "..."}
+//
+// It must answer each request with one line holding a JSON object of the
+// fields it extracted ({} when it has none). The plugin must flush stdout
+// after every answer line: a plugin that buffers its output looks hung, and
+// once it has not answered within the timeout (10s unless set, as a Go
+// duration) it is killed and the group being parsed fails.
+type ParserConfig struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"`
+	Timeout string            `json:"timeout"`
+}
+
+// defaultParserTimeout is how long a parser gets to answer one record.
+const defaultParserTimeout = 10 * time.Second
+
+// parserTimeoutError reports a parser that did not answer a record in time.
+// It fails the whole group rather than just the record, because the plugin
+// is killed.
+type parserTimeoutError struct {
+	name    string
+	timeout time.Duration
+}
+
+func (e *parserTimeoutError) Error() string {
+	return fmt.Sprintf("parser %q did not answer within %s; is it flushing stdout after each line?", e.name, e.timeout)
+}
+
+// GroupConfig holds per log group settings. Groups are matched by name
+// pattern, e.g. "/aws/ecs/*".
+type GroupConfig struct {
+	Parser string `json:"parser"`
+}
+
+type parserRequest struct {
+	Message   string `json:"message"`
+	Group     string `json:"group"`
+	LogStream string `json:"logStream"`
+}
+
+type execParser struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	enc     *json.Encoder
+	lines   chan []byte
+	err     error // why lines was closed
+	timeout time.Duration
+}
+
+func startParser(name string, c ParserConfig) (*execParser, error) {
+	if len(c.Command) == 0 {
+		return nil, fmt.Errorf("parser %q has no command", name)
+	}
+	timeout := defaultParserTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("parser %q: invalid timeout %q", name, c.Timeout)
+		}
+		timeout = d
+	}
+	cmd := exec.Command(c.Command[0], c.Command[1:]...)
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range c.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("parser %q: %w", name, err)
+	}
+	p := &execParser{name: name, cmd: cmd, stdin: stdin, enc: json.NewEncoder(stdin), lines: make(chan []byte), timeout: timeout}
+	go p.read(stdout)
+	return p, nil
+}
+
+// read feeds the lines of the parser's stdout to p.lines until it ends, so
+// Parse can give up on a plugin that stops answering.
+func (p *execParser) read(stdout io.Reader) {
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		p.lines <- append([]byte(nil), sc.Bytes()...)
+	}
+	p.err = fmt.Errorf("parser %q exited", p.name)
+	if err := sc.Err(); err != nil {
+		p.err = fmt.Errorf("parser %q: %w", p.name, err)
+	}
+	close(p.lines)
+}
+
+// Parse sends one record to the plugin and returns the fields it extracted.
+// It waits at most p.timeout for the answer, or until ctx is done.
+func (p *execParser) Parse(ctx context.Context, group string, r QueryResult) (map[string]interface{}, error) {
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- p.enc.Encode(parserRequest{Message: r.Message, Group: group, LogStream: r.LogStream})
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			return nil, fmt.Errorf("parser %q: %w", p.name, err)
+		}
+	case <-timer.C:
+		return nil, &parserTimeoutError{name: p.name, timeout: p.timeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var line []byte
+	select {
+	case b, ok := <-p.lines:
+		if !ok {
+			return nil, p.err
+		}
+		line = b
+	case <-timer.C:
+		return nil, &parserTimeoutError{name: p.name, timeout: p.timeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, fmt.Errorf("parser %q: %w", p.name, err)
+	}
+	return fields, nil
+}
+
+// Close ends the plugin's input and waits for it to exit. Anything it
+// still writes is discarded.
+func (p *execParser) Close() error {
+	p.stdin.Close()
+	for range p.lines {
+	}
+	return p.cmd.Wait()
+}
+
+// kill stops a parser that no longer answers.
+func (p *execParser) kill() {
+	p.cmd.Process.Kill()
+	p.Close()
+}
+
+// parsers holds the plugins started so far in this run, by name.
+var parsers = struct {
+	sync.Mutex
+	running map[string]*execParser
+}{running: make(map[string]*execParser)}
+
+// parserFor returns the parser configured for group, starting it on first
+// use, or nil when the group has none. When several patterns match, the
+// longest wins.
+func parserFor(group string) (*execParser, error) {
+	var name, matched string
+	for pattern, g := range conf.Groups {
+		if ok, _ := path.Match(pattern, group); ok && g.Parser != "" && len(pattern) > len(matched) {
+			name, matched = g.Parser, pattern
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	parsers.Lock()
+	defer parsers.Unlock()
+	if p, ok := parsers.running[name]; ok {
+		return p, nil
+	}
+	c, ok := conf.Parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("no parser %q in config", name)
+	}
+	p, err := startParser(name, c)
+	if err != nil {
+		return nil, err
+	}
+	parsers.running[name] = p
+	return p, nil
+}
+
+// parseFields fills in the structured fields of each record using the
+// group's parser plugin. Records the plugin fails on are kept as they are.
+// A plugin that times out, or is abandoned because ctx is done, is killed
+// and dropped so the next group starts a fresh one.
+func parseFields(ctx context.Context, group string, res []QueryResult) ([]QueryResult, error) {
+	p, err := parserFor(group)
+	if err != nil || p == nil {
+		return res, err
+	}
+	parsers.Lock()
+	defer parsers.Unlock()
+	for i := range res {
+		fields, err := p.Parse(ctx, group, res[i])
+		if _, stalled := err.(*parserTimeoutError); stalled || ctx.Err() != nil {
+			p.kill()
+			delete(parsers.running, p.name)
+			return res, err
+		}
+		if err != nil {
+			return res, err
+		}
+		res[i].Fields = fields
+	}
+	return res, nil
+}
+
+// closeParsers stops every parser plugin started during the run.
+func closeParsers() error {
+	parsers.Lock()
+	defer parsers.Unlock()
+	var first error
+	for name, p := range parsers.running {
+		if err := p.Close(); err != nil && first == nil {
+			first = fmt.Errorf("parser %q: %w", name, err)
+		}
+		delete(parsers.running, name)
+	}
+	return first
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParserTimeout(t *testing.T) {
+	saved := conf
+	defer func() { conf = saved }()
+	conf = Config{
+		Parsers: map[string]ParserConfig{
+			"echo":  {Command: []string{"sh", "-c", `while read l; do echo '{"ok":true}'; done`}},
+			"stuck": {Command: []string{"sh", "-c", "cat >/dev/null"}, Timeout: "100ms"},
+		},
+		Groups: map[string]GroupConfig{
+			"/echo/*":  {Parser: "echo"},
+			"/stuck/*": {Parser: "stuck"},
+		},
+	}
+	defer closeParsers()
+
+	res, err := parseFields(context.Background(), "/echo/a", []QueryResult{{Message: "x"}, {Message: "y"}})
+	if err != nil {
+		t.Fatalf("echo parser: %v", err)
+	}
+	for _, r := range res {
+		if r.Fields["ok"] != true {
+			t.Errorf("fields = %v, want ok", r.Fields)
+		}
+	}
+
+	_, err = parseFields(context.Background(), "/stuck/a", []QueryResult{{Message: "x"}})
+	if _, ok := err.(*parserTimeoutError); !ok {
+		t.Fatalf("stuck parser: err = %v, want a timeout", err)
+	}
+	parsers.Lock()
+	_, running := parsers.running["stuck"]
+	parsers.Unlock()
+	if running {
+		t.Error("stuck parser still registered after the timeout")
+	}
+}
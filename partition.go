@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// defaultRegion is used when neither --region, the environment nor the
+// profile name a region.
+const defaultRegion = "ap-northeast-1"
+
+// Partition returns the ID of the AWS partition region belongs to, e.g. aws,
+// aws-cn or aws-us-gov.
+func Partition(region string) string {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return p.ID()
+	}
+	return endpoints.AwsPartitionID
+}
+
+// consoleHost returns the console host name for region; each partition has
+// its own console domain.
+func consoleHost(region string) string {
+	switch Partition(region) {
+	case endpoints.AwsCnPartitionID:
+		return region + ".console.amazonaws.cn"
+	case endpoints.AwsUsGovPartitionID:
+		return "console.amazonaws-us-gov.com"
+	}
+	return region + ".console.aws.amazon.com"
+}
+
+// consoleEscape encodes s the way the CloudWatch console expects in its
+// fragment, where % itself is escaped as $25.
+func consoleEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "%", "$25")
+}
+
+// ConsoleURL links to logGroup in the CloudWatch console of region.
+func ConsoleURL(region, logGroup string) string {
+	return fmt.Sprintf("https://%s/cloudwatch/home?region=%s#logsV2:log-groups/log-group/%s",
+		consoleHost(region), url.QueryEscape(region), consoleEscape(logGroup))
+}
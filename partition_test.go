@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestPartition(t *testing.T) {
+	tests := []struct {
+		region, partition, host string
+	}{
+		{"ap-northeast-1", "aws", "ap-northeast-1.console.aws.amazon.com"},
+		{"us-east-1", "aws", "us-east-1.console.aws.amazon.com"},
+		{"cn-north-1", "aws-cn", "cn-north-1.console.amazonaws.cn"},
+		{"cn-northwest-1", "aws-cn", "cn-northwest-1.console.amazonaws.cn"},
+		{"us-gov-west-1", "aws-us-gov", "console.amazonaws-us-gov.com"},
+		{"us-gov-east-1", "aws-us-gov", "console.amazonaws-us-gov.com"},
+		{"xx-nowhere-1", "aws", "xx-nowhere-1.console.aws.amazon.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			if got := Partition(tt.region); got != tt.partition {
+				t.Errorf("Partition(%q) = %q, want %q", tt.region, got, tt.partition)
+			}
+			if got := consoleHost(tt.region); got != tt.host {
+				t.Errorf("consoleHost(%q) = %q, want %q", tt.region, got, tt.host)
+			}
+		})
+	}
+}
+
+func TestConsoleURL(t *testing.T) {
+	tests := []struct {
+		region, group, want string
+	}{
+		{
+			"ap-northeast-1", "/ecs/api",
+			"https://ap-northeast-1.console.aws.amazon.com/cloudwatch/home?region=ap-northeast-1#logsV2:log-groups/log-group/$252Fecs$252Fapi",
+		},
+		{
+			"cn-northwest-1", "/aws/lambda/fn",
+			"https://cn-northwest-1.console.amazonaws.cn/cloudwatch/home?region=cn-northwest-1#logsV2:log-groups/log-group/$252Faws$252Flambda$252Ffn",
+		},
+		{
+			"us-gov-west-1", "app",
+			"https://console.amazonaws-us-gov.com/cloudwatch/home?region=us-gov-west-1#logsV2:log-groups/log-group/app",
+		},
+	}
+	for _, tt := range tests {
+		if got := ConsoleURL(tt.region, tt.group); got != tt.want {
+			t.Errorf("ConsoleURL(%q, %q) = %q, want %q", tt.region, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestNewSessionRegion(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(config, []byte("[profile gov]\nregion = us-gov-west-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_DEFAULT_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	saved := opts
+	defer func() { opts = saved }()
+
+	tests := []struct {
+		name, region, profile, env, want string
+	}{
+		{"fallback", "", "", "", defaultRegion},
+		{"flag", "cn-north-1", "", "", "cn-north-1"},
+		{"environment", "", "", "eu-west-1", "eu-west-1"},
+		{"flag over environment", "cn-northwest-1", "", "eu-west-1", "cn-northwest-1"},
+		{"profile", "", "gov", "", "us-gov-west-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", tt.env)
+			opts.Region, opts.Profile = tt.region, tt.profile
+			sess, err := newSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := aws.StringValue(sess.Config.Region); got != tt.want {
+				t.Errorf("region = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
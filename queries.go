@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+)
+
+type queriesCommand struct {
+	List   queriesListCommand   `command:"list" description:"List running and scheduled Insights queries"`
+	Cancel queriesCancelCommand `command:"cancel" description:"Cancel running Insights queries"`
+}
+
+type queriesListCommand struct {
+	Group string `long:"group" description:"only list queries against this log group"`
+}
+
+type queriesCancelCommand struct {
+	All  bool `long:"all" description:"cancel every running and scheduled query"`
+	Args struct {
+		IDs []string `positional-arg-name:"id"`
+	} `positional-args:"yes"`
+}
+
+var queriesOpts queriesCommand
+
+// ActiveQueries returns the queries that are running or scheduled, optionally
+// limited to one log group.
+func (l Logs) ActiveQueries(ctx context.Context, logGroup string) ([]*cloudwatchlogs.QueryInfo, error) {
+	var queries []*cloudwatchlogs.QueryInfo
+	for _, status := range []string{cloudwatchlogs.QueryStatusRunning, cloudwatchlogs.QueryStatusScheduled} {
+		input := &cloudwatchlogs.DescribeQueriesInput{Status: aws.String(status)}
+		if logGroup != "" {
+			input.LogGroupName = aws.String(logGroup)
+		}
+		for {
+			out, err := l.client().DescribeQueriesWithContext(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, out.Queries...)
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+	}
+	return queries, nil
+}
+
+func printQueries(w io.Writer, queries []*cloudwatchlogs.QueryInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUERY ID\tSTATUS\tCREATED\tLOG GROUP\tQUERY")
+	for _, q := range queries {
+		created := time.UnixMilli(aws.Int64Value(q.CreateTime)).Format(time.RFC3339)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			aws.StringValue(q.QueryId), aws.StringValue(q.Status), created,
+			aws.StringValue(q.LogGroupName), aws.StringValue(q.QueryString))
+	}
+	return tw.Flush()
+}
+
+func runQueriesList(ctx context.Context, l *Logs) error {
+	queries, err := l.ActiveQueries(ctx, queriesOpts.List.Group)
+	if err != nil {
+		return err
+	}
+	return printQueries(stdout, queries)
+}
+
+func runQueriesCancel(ctx context.Context, l *Logs) error {
+	ids := queriesOpts.Cancel.Args.IDs
+	if queriesOpts.Cancel.All {
+		queries, err := l.ActiveQueries(ctx, "")
+		if err != nil {
+			return err
+		}
+		ids = nil
+		for _, q := range queries {
+			ids = append(ids, aws.StringValue(q.QueryId))
+		}
+	}
+	if len(ids) == 0 && !queriesOpts.Cancel.All {
+		return errors.New("specify query IDs to cancel or --all")
+	}
+
+	var failed int
+	for _, id := range ids {
+		if err := l.Stop(id); err != nil {
+			l.logger.Warn("cancel query", zap.String("id", id), zap.Error(err))
+			failed++
+			continue
+		}
+		fmt.Fprintln(stdout, id)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to cancel %d of %d queries", failed, len(ids))
+	}
+	return nil
+}
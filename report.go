@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"os"
+	"time"
+)
+
+// insightsTimeLayout is the format of @timestamp values returned by Logs
+// Insights, always in UTC.
+const insightsTimeLayout = "2006-01-02 15:04:05.000"
+
+type reportCommand struct {
+	HTML    reportHTMLCommand    `command:"html" description:"Write a self-contained HTML report"`
+	Grafana reportGrafanaCommand `command:"grafana" description:"Write a Grafana dashboard for the query and groups"`
+}
+
+type reportHTMLCommand struct {
+	File  string `short:"f" long:"file" description:"write the report to this file instead of stdout"`
+	Title string `long:"title" description:"report title" default:"CloudWatch Logs report"`
+}
+
+var reportOpts reportCommand
+
+// Histogram counts times into buckets evenly spaced between from and to.
+// Times outside the range are ignored.
+func Histogram(times []time.Time, from, to time.Time, buckets int) []int {
+	counts := make([]int, buckets)
+	width := to.Sub(from) / time.Duration(buckets)
+	if width <= 0 {
+		return counts
+	}
+	for _, t := range times {
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+		counts[int(t.Sub(from)/width)]++
+	}
+	return counts
+}
+
+type reportBar struct {
+	X, Y, Width, Height float64
+	Label               string
+	Count               int
+}
+
+type reportGroup struct {
+	Name           string
+	ConsoleURL     string
+	Matches        int
+	RecordsScanned float64
+	BytesScanned   float64
+}
+
+type reportData struct {
+	Title     string
+	Query     string
+	Start     string
+	End       string
+	Generated string
+	Total     int
+	Bars      []reportBar
+	Groups    []reportGroup
+	Records   []record
+}
+
+const (
+	reportBuckets     = 60
+	reportChartWidth  = 900.0
+	reportChartHeight = 160.0
+)
+
+// htmlFormatter buffers the run and renders a single HTML page on Close.
+type htmlFormatter struct {
+	*collector
+	w        io.Writer
+	title    string
+	query    string
+	from, to time.Time
+}
+
+func (f *htmlFormatter) Close() error {
+	data := reportData{
+		Title:     f.title,
+		Query:     f.query,
+		Start:     f.from.Format(time.RFC3339),
+		End:       f.to.Format(time.RFC3339),
+		Generated: time.Now().Format(time.RFC3339),
+		Total:     len(f.records),
+		Records:   f.records,
+	}
+
+	var times []time.Time
+	for _, r := range f.records {
+		if t, err := time.Parse(insightsTimeLayout, r.Timestamp); err == nil {
+			times = append(times, t)
+		}
+	}
+	counts := Histogram(times, f.from, f.to, reportBuckets)
+	peak := 1
+	for _, c := range counts {
+		if c > peak {
+			peak = c
+		}
+	}
+	width := reportChartWidth / reportBuckets
+	step := f.to.Sub(f.from) / reportBuckets
+	for i, c := range counts {
+		h := reportChartHeight * float64(c) / float64(peak)
+		data.Bars = append(data.Bars, reportBar{
+			X:      float64(i) * width,
+			Y:      reportChartHeight - h,
+			Width:  width - 1,
+			Height: h,
+			Label:  f.from.Add(step * time.Duration(i)).Format(time.RFC3339),
+			Count:  c,
+		})
+	}
+
+	for _, g := range f.groups {
+		rg := reportGroup{Name: g.Group, ConsoleURL: ConsoleURL(opts.Region, g.Group), Matches: f.matches[g.Group]}
+		if s := g.Statistics; s != nil {
+			rg.RecordsScanned = s.RecordsScanned
+			rg.BytesScanned = s.BytesScanned
+		}
+		data.Groups = append(data.Groups, rg)
+	}
+
+	return reportTemplate.Execute(f.w, data)
+}
+
+func runReportHTML(ctx context.Context, l *Logs) (*Summary, error) {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, err
+	}
+	q, err := assembleQuery(l)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := l.PlanTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckScanSize(targets); err != nil {
+		return nil, err
+	}
+
+	w := io.Writer(stdout)
+	if reportOpts.HTML.File != "" {
+		file, err := os.Create(reportOpts.HTML.File)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	out := &htmlFormatter{
+		collector: newCollector(true),
+		w:         w,
+		title:     reportOpts.HTML.Title,
+		query:     q,
+		from:      from,
+		to:        to,
+	}
+	summary := run(ctx, l, targets, q, out)
+	return summary, out.Close()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+code, td.msg { font-family: SFMono-Regular, Menlo, Consolas, monospace; font-size: 12px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.msg { white-space: pre-wrap; word-break: break-all; }
+svg rect { fill: #0969da; }
+svg rect:hover { fill: #cf222e; }
+#filter { width: 100%; padding: 6px; margin-bottom: 1em; box-sizing: border-box; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated}}</p>
+<h2>Query</h2>
+<p><code>{{.Query}}</code></p>
+<p>{{.Start}} &ndash; {{.End}}</p>
+
+<h2>Matches over time ({{.Total}})</h2>
+<svg width="900" height="160" viewBox="0 0 900 160">
+{{- range .Bars}}
+<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}: {{.Count}}</title></rect>
+{{- end}}
+</svg>
+
+<h2>Groups</h2>
+<table>
+<tr><th>Group</th><th>Matches</th><th>Records scanned</th><th>Bytes scanned</th></tr>
+{{- range .Groups}}
+<tr><td><a href="{{.ConsoleURL}}">{{.Name}}</a></td><td>{{.Matches}}</td><td>{{.RecordsScanned}}</td><td>{{.BytesScanned}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Results</h2>
+<input id="filter" type="search" placeholder="Filter results">
+<table id="results">
+<tr><th>Timestamp</th><th>Group</th><th>Log stream</th><th>Message</th></tr>
+{{- range .Records}}
+<tr><td>{{.Timestamp}}</td><td>{{.Group}}</td><td>{{.LogStream}}</td><td class="msg">{{.Message}}</td></tr>
+{{- end}}
+</table>
+<script>
+document.getElementById("filter").addEventListener("input", function (e) {
+  var q = e.target.value.toLowerCase();
+  var rows = document.querySelectorAll("#results tr");
+  for (var i = 1; i < rows.length; i++) {
+    rows[i].style.display = rows[i].textContent.toLowerCase().indexOf(q) === -1 ? "none" : "";
+  }
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// SinkConfig describes an exec sink plugin: a command that receives every
+// record as one line of NDJSON on its stdin, with query metadata included.
+// stdin is closed when the run ends, and a non-zero exit status is reported
+// as a sink failure.
+type SinkConfig struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"`
+}
+
+type execSink struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	buf   *bufio.Writer
+	out   Formatter
+}
+
+func startSink(name string, c SinkConfig) (*execSink, error) {
+	if len(c.Command) == 0 {
+		return nil, fmt.Errorf("sink %q has no command", name)
+	}
+	cmd := exec.Command(c.Command[0], c.Command[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range c.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("sink %q: %w", name, err)
+	}
+	buf := bufio.NewWriter(stdin)
+	return &execSink{
+		name:  name,
+		cmd:   cmd,
+		stdin: stdin,
+		buf:   buf,
+		out:   &ndjsonFormatter{enc: json.NewEncoder(buf), withMeta: true},
+	}, nil
+}
+
+func (s *execSink) Write(meta *QueryMeta, res []QueryResult) error {
+	if err := s.out.Write(meta, res); err != nil {
+		return fmt.Errorf("sink %q: %w", s.name, err)
+	}
+	return nil
+}
+
+func (s *execSink) Close() error {
+	werr := s.buf.Flush()
+	s.stdin.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("sink %q: %w", s.name, err)
+	}
+	if werr != nil {
+		return fmt.Errorf("sink %q: %w", s.name, werr)
+	}
+	return nil
+}
+
+// teeFormatter writes every result to each of its formatters.
+type teeFormatter []Formatter
+
+// Write continues past a failing formatter so one broken sink doesn't starve
+// the others; the first error is returned.
+func (t teeFormatter) Write(meta *QueryMeta, res []QueryResult) error {
+	var first error
+	for _, f := range t {
+		if err := f.Write(meta, res); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t teeFormatter) Close() error {
+	var first error
+	for _, f := range t {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// newOutput returns the --output formatter, teed to every --sink.
+func newOutput() (Formatter, error) {
+	out, err := NewFormatter(opts.Output, stdout, opts.WithMeta)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Sinks) == 0 {
+		return out, nil
+	}
+
+	tee := teeFormatter{out}
+	for _, name := range opts.Sinks {
+		c, ok := conf.Sinks[name]
+		if !ok {
+			tee.Close()
+			return nil, fmt.Errorf("no sink %q in config", name)
+		}
+		s, err := startSink(name, c)
+		if err != nil {
+			tee.Close()
+			return nil, err
+		}
+		tee = append(tee, s)
+	}
+	return tee, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runState is what the state store remembers about a named query.
+type runState struct {
+	LastEnd time.Time `json:"lastEnd"`
+}
+
+func statePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloud-watch-client", "state.json"), nil
+}
+
+func loadState() (map[string]runState, error) {
+	state := make(map[string]runState)
+	path, err := statePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+func saveState(state map[string]runState) error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// applySinceLastRun moves the window of the named query so it starts just
+// after its previous successful run ended. Both ends of a window are
+// inclusive, so starting a second later keeps events on the boundary from
+// being returned twice. Unless --end was given the window ends now. The
+// first run has nothing to start from, so it needs --start.
+func applySinceLastRun(startSet, endSet bool) error {
+	if opts.Name == "" {
+		return errors.New("--since-last-run needs --name")
+	}
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	s, ok := state[opts.Name]
+	if ok {
+		opts.Start = s.LastEnd.Add(time.Second).Format(time.RFC3339)
+	} else if !startSet {
+		return fmt.Errorf("no previous run of %q; give --start for the first one", opts.Name)
+	}
+	if !endSet {
+		opts.End = time.Now().Truncate(time.Second).Format(time.RFC3339)
+	}
+	if !ok {
+		return nil
+	}
+	end, err := ParseTime(opts.End)
+	if err != nil {
+		return err
+	}
+	if !end.After(s.LastEnd) {
+		if endSet {
+			return fmt.Errorf("--end %s is not after the end of the last run of %q (%s)", opts.End, opts.Name, s.LastEnd.Format(time.RFC3339))
+		}
+		return fmt.Errorf("nothing new since the last run of %q ended at %s", opts.Name, s.LastEnd.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// recordRun stores the end of the window just searched as the start of the
+// next --since-last-run window.
+func recordRun() error {
+	end, err := ParseTime(opts.End)
+	if err != nil {
+		return err
+	}
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	state[opts.Name] = runState{LastEnd: end}
+	return saveState(state)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplySinceLastRun(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	saved := opts
+	defer func() { opts = saved }()
+
+	lastEnd := time.Date(2022, 9, 22, 0, 30, 0, 0, time.UTC)
+	if err := saveState(map[string]runState{"api": {LastEnd: lastEnd}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		start     string
+		end       string
+		startSet  bool
+		endSet    bool
+		wantStart string
+		wantErr   bool
+	}{
+		{name: "starts after the last end", query: "api", end: "2022-09-22T01:00:00Z", endSet: true, wantStart: "2022-09-22T00:30:01Z"},
+		{name: "given start is overridden", query: "api", start: "2022-09-21T00:00:00Z", startSet: true, end: "2022-09-22T01:00:00Z", endSet: true, wantStart: "2022-09-22T00:30:01Z"},
+		{name: "end before the derived start", query: "api", end: "2022-09-22T00:10:00Z", endSet: true, wantErr: true},
+		{name: "end at the last end", query: "api", end: "2022-09-22T00:30:00Z", endSet: true, wantErr: true},
+		{name: "end defaults to now", query: "api", wantStart: "2022-09-22T00:30:01Z"},
+		{name: "first run needs start", query: "new", wantErr: true},
+		{name: "first run with start", query: "new", start: "2022-09-22T00:00:00Z", startSet: true, wantStart: "2022-09-22T00:00:00Z"},
+		{name: "needs a name", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts.Name, opts.Start, opts.End = tt.query, tt.start, tt.end
+			err := applySinceLastRun(tt.startSet, tt.endSet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && opts.Start != tt.wantStart {
+				t.Errorf("start = %s, want %s", opts.Start, tt.wantStart)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// names holds the log group names (or, for results, query IDs) given as
+// arguments. A "-" argument is replaced by the whitespace-separated names
+// read from stdin, so output such as
+// `aws logs describe-log-groups --query 'logGroups[].logGroupName' --output text`
+// can be piped straight in. Reading no names there is an error: searching
+// every group under the prefix instead would hide a failed pipeline.
+var names []string
+
+func readNames(args []string, stdin io.Reader) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		if arg != "-" {
+			out = append(out, arg)
+			continue
+		}
+		sc := bufio.NewScanner(stdin)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		read := len(out)
+		for sc.Scan() {
+			out = append(out, strings.Fields(sc.Text())...)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		if len(out) == read {
+			return nil, errors.New("no names on stdin")
+		}
+	}
+	return out, nil
+}
+
+// readArgs sets names from the arguments left after parsing flags.
+func readArgs(args []string) error {
+	var err error
+	names, err = readNames(args, os.Stdin)
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "literal names only", args: []string{"/a", "/b"}, stdin: "/ignored", want: []string{"/a", "/b"}},
+		{name: "no args", want: nil},
+		{name: "aws --output text is tab separated", args: []string{"-"}, stdin: "/aws/lambda/a\t/aws/lambda/b\t/ecs/c\n", want: []string{"/aws/lambda/a", "/aws/lambda/b", "/ecs/c"}},
+		{name: "newline separated", args: []string{"-"}, stdin: "/a\n/b\n\n/c", want: []string{"/a", "/b", "/c"}},
+		{name: "mixed with literal names keeps the order", args: []string{"/first", "-", "/last"}, stdin: "/x\t/y\n/z\n", want: []string{"/first", "/x", "/y", "/z", "/last"}},
+		{name: "empty stdin", args: []string{"-"}, stdin: "", wantErr: true},
+		{name: "blank stdin", args: []string{"/a", "-"}, stdin: " \n\t\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readNames(tt.args, strings.NewReader(tt.stdin))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readNames(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
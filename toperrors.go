@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type topErrorsCommand struct {
+	Limit int `long:"limit" description:"number of fingerprints to show" default:"20"`
+}
+
+var topErrorsOpts topErrorsCommand
+
+// TopError is a fingerprint with its counts in the current and the previous
+// window.
+type TopError struct {
+	*FingerprintGroup
+	Previous int
+}
+
+// Trend compares the count with the previous window.
+func (e TopError) Trend() string {
+	switch {
+	case e.Previous == 0:
+		return "new"
+	case e.Count > e.Previous:
+		return "↑"
+	case e.Count < e.Previous:
+		return "↓"
+	}
+	return "→"
+}
+
+// RankErrors orders the fingerprints of current by count, attaching the
+// count each had in previous.
+func RankErrors(current, previous []record) []TopError {
+	prev := make(map[string]int)
+	for _, g := range GroupByFingerprint(previous) {
+		prev[g.Fingerprint] = g.Count
+	}
+	var ranked []TopError
+	for _, g := range GroupByFingerprint(current) {
+		ranked = append(ranked, TopError{FingerprintGroup: g, Previous: prev[g.Fingerprint]})
+	}
+	return ranked
+}
+
+// searchWindow runs the search over [from, to] and returns every record.
+func searchWindow(ctx context.Context, l *Logs, targets []Target, query string, from, to time.Time) ([]record, *Summary) {
+	start, end := opts.Start, opts.End
+	defer func() { opts.Start, opts.End = start, end }()
+	opts.Start, opts.End = from.Format(time.RFC3339), to.Format(time.RFC3339)
+
+	c := newCollector(false)
+	summary := run(ctx, l, targets, query, c)
+	return c.records, summary
+}
+
+func runTopErrors(ctx context.Context, l *Logs) (*Summary, error) {
+	from, err := ParseTime(opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseTime(opts.End)
+	if err != nil {
+		return nil, err
+	}
+	q, err := assembleQuery(l)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := l.PlanTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The previous window is as long as the current one, so it scans about
+	// as much again.
+	if err := l.checkScanSize(targets, 2); err != nil {
+		return nil, err
+	}
+
+	current, summary := searchWindow(ctx, l, targets, q, from, to)
+	previous, prevSummary := searchWindow(ctx, l, targets, q, from.Add(-to.Sub(from)), from)
+	for _, f := range prevSummary.Failed {
+		l.logger.Warn("previous window", zap.String("group", f.Group), zap.Error(f.Err))
+	}
+	summary.BytesScanned += prevSummary.BytesScanned
+
+	ranked := RankErrors(current, previous)
+	if n := topErrorsOpts.Limit; n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return summary, printTopErrors(stdout, ranked)
+}
+
+func printTopErrors(w io.Writer, ranked []TopError) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINGERPRINT\tCOUNT\tPREV\tTREND\tGROUPS\tSAMPLE")
+	for _, e := range ranked {
+		names := make([]string, 0, len(e.Groups))
+		for name := range e.Groups {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return e.Groups[names[i]] > e.Groups[names[j]] })
+		var groups []string
+		for _, name := range names {
+			groups = append(groups, fmt.Sprintf("%s=%d", name, e.Groups[name]))
+		}
+		sample := truncate(strings.SplitN(e.Sample, "\n", 2)[0], 100, "…")
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", e.Fingerprint, e.Count, e.Previous, e.Trend(), strings.Join(groups, ","), sample)
+	}
+	return tw.Flush()
+}
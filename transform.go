@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// transform is the compiled --transform program, nil when none was given.
+var transform *vm.Program
+
+// transformEnv is what a --transform program sees for each record.
+func transformEnv(group string, r QueryResult) map[string]interface{} {
+	fields := r.Fields
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"timestamp": r.Timestamp,
+		"logStream": r.LogStream,
+		"message":   r.Message,
+		"group":     group,
+		"level":     DetectLevel(r.Message).String(),
+		"fields":    fields,
+	}
+}
+
+// sub replaces every match of pattern in s, e.g. to redact addresses:
+// sub(`10\.\d+\.\d+\.\d+`, "<ip>", message).
+var subFunction = expr.Function("sub", func(params ...interface{}) (interface{}, error) {
+	re, err := regexp.Compile(params[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(params[2].(string), params[1].(string)), nil
+}, new(func(string, string, string) string))
+
+// compileTransform compiles src, or the contents of the file it names when
+// it starts with @.
+func compileTransform(src string) (*vm.Program, error) {
+	if len(src) > 1 && src[0] == '@' {
+		b, err := os.ReadFile(src[1:])
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+	}
+	return expr.Compile(src, expr.Env(transformEnv("", QueryResult{})), subFunction)
+}
+
+// applyTransform runs the transform program on every record. The program
+// decides what happens to a record by what it returns:
+//
+//	bool    keep the record only when true
+//	string  replace the message
+//	map     merge into the fields; a "message" key replaces the message
+//	nil     keep the record unchanged
+//
+// A record the program fails on, e.g. by comparing a field the record
+// doesn't have, is kept unchanged. The error returned counts those records
+// and carries the first failure.
+func applyTransform(group string, res []QueryResult) ([]QueryResult, error) {
+	if transform == nil {
+		return res, nil
+	}
+	var failed int
+	var first error
+	fail := func(err error) {
+		if failed++; first == nil {
+			first = err
+		}
+	}
+	kept := res[:0]
+	for _, r := range res {
+		out, err := expr.Run(transform, transformEnv(group, r))
+		if err != nil {
+			fail(err)
+			kept = append(kept, r)
+			continue
+		}
+		switch v := out.(type) {
+		case nil:
+		case bool:
+			if !v {
+				continue
+			}
+		case string:
+			r.Message = v
+		case map[string]interface{}:
+			fields := make(map[string]interface{}, len(r.Fields)+len(v))
+			for k, f := range r.Fields {
+				fields[k] = f
+			}
+			for k, f := range v {
+				if k == "message" {
+					r.Message = fmt.Sprint(f)
+					continue
+				}
+				fields[k] = f
+			}
+			r.Fields = fields
+		default:
+			fail(fmt.Errorf("transform returned %T, want bool, string or map", out))
+		}
+		kept = append(kept, r)
+	}
+	if first != nil {
+		return kept, fmt.Errorf("%d of %d records kept unchanged: %w", failed, len(res), first)
+	}
+	return kept, nil
+}
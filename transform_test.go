@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyTransform(t *testing.T) {
+	input := func() []QueryResult {
+		return []QueryResult{
+			{Message: "ERROR db down from 10.0.1.2", Fields: map[string]interface{}{"status": 503.0}},
+			{Message: "INFO ok"},
+		}
+	}
+	tests := []struct {
+		name    string
+		src     string
+		want    []QueryResult
+		wantErr string
+	}{
+		{
+			name: "bool keeps only true",
+			src:  `level == "error"`,
+			want: []QueryResult{{Message: "ERROR db down from 10.0.1.2", Fields: map[string]interface{}{"status": 503.0}}},
+		},
+		{
+			name: "bool false drops everything",
+			src:  `false`,
+			want: []QueryResult{},
+		},
+		{
+			name: "string rewrites the message",
+			src:  `sub("10\\.\\d+\\.\\d+\\.\\d+", "<ip>", message)`,
+			want: []QueryResult{
+				{Message: "ERROR db down from <ip>", Fields: map[string]interface{}{"status": 503.0}},
+				{Message: "INFO ok"},
+			},
+		},
+		{
+			name: "map merges fields and overrides the message",
+			src:  `{"group": group, "message": "[" + level + "] " + message}`,
+			want: []QueryResult{
+				{Message: "[error] ERROR db down from 10.0.1.2", Fields: map[string]interface{}{"status": 503.0, "group": "/app"}},
+				{Message: "[info] INFO ok", Fields: map[string]interface{}{"group": "/app"}},
+			},
+		},
+		{
+			name: "nil passes through",
+			src:  `nil`,
+			want: input(),
+		},
+		{
+			name: "runtime error keeps the record",
+			src:  `fields.status > 500`,
+			want: []QueryResult{
+				{Message: "ERROR db down from 10.0.1.2", Fields: map[string]interface{}{"status": 503.0}},
+				{Message: "INFO ok"},
+			},
+			wantErr: "1 of 2 records kept unchanged",
+		},
+		{
+			name:    "other type keeps the record",
+			src:     `len(message)`,
+			want:    input(),
+			wantErr: "2 of 2 records kept unchanged",
+		},
+	}
+
+	saved := transform
+	defer func() { transform = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if transform, err = compileTransform(tt.src); err != nil {
+				t.Fatalf("compileTransform(%q): %v", tt.src, err)
+			}
+			got, err := applyTransform("/app", input())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyTransform = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTransformNone(t *testing.T) {
+	saved := transform
+	defer func() { transform = saved }()
+	transform = nil
+	res := []QueryResult{{Message: "a"}}
+	if got, err := applyTransform("/app", res); err != nil || !reflect.DeepEqual(got, res) {
+		t.Errorf("applyTransform without a program = %v, %v", got, err)
+	}
+}
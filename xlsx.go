@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// xlsxMaxCell is the longest text Excel accepts in a single cell.
+const xlsxMaxCell = 32767
+
+// xlsxFormatter buffers every record and writes a workbook with a results
+// sheet and a per-group summary sheet on Close.
+type xlsxFormatter struct {
+	*collector
+	w io.Writer
+}
+
+func newXLSXFormatter(w io.Writer, withMeta bool) *xlsxFormatter {
+	return &xlsxFormatter{collector: newCollector(withMeta), w: w}
+}
+
+func (f *xlsxFormatter) Close() error {
+	header := []string{"Timestamp", "Group", "Log Stream", "Message"}
+	if f.withMeta {
+		header = append(header, "Query ID")
+	}
+	results := [][]interface{}{}
+	for _, r := range f.records {
+		row := []interface{}{r.Timestamp, r.Group, r.LogStream, r.Message}
+		if f.withMeta {
+			row = append(row, r.Query.ID)
+		}
+		results = append(results, row)
+	}
+
+	summary := [][]interface{}{}
+	for _, g := range f.groups {
+		row := []interface{}{g.Group, f.matches[g.Group]}
+		if s := g.Statistics; s != nil {
+			row = append(row, s.RecordsScanned, s.BytesScanned)
+		}
+		summary = append(summary, row)
+	}
+
+	z := zip.NewWriter(f.w)
+	files := []struct {
+		name string
+		body []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRels)},
+		{"xl/workbook.xml", []byte(fmt.Sprintf(xlsxWorkbook, xlsxRange(len(header), len(results)+1)))},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(header, results, true)},
+		{"xl/worksheets/sheet2.xml", xlsxSheet([]string{"Group", "Matches", "Records Scanned", "Bytes Scanned"}, summary, false)},
+	}
+	for _, file := range files {
+		fw, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(file.body); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// xlsxColumn returns the column letters for a zero-based index.
+func xlsxColumn(i int) string {
+	var col []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		col = append([]byte{byte('A' + (i-1)%26)}, col...)
+	}
+	return string(col)
+}
+
+func xlsxRange(cols, rows int) string {
+	return fmt.Sprintf("$A$1:$%s$%d", xlsxColumn(cols-1), rows)
+}
+
+func xlsxSheet(header []string, rows [][]interface{}, filter bool) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+	headerRow := make([]interface{}, len(header))
+	for i, h := range header {
+		headerRow[i] = h
+	}
+	xlsxRow(&b, 1, headerRow, 1)
+	for i, row := range rows {
+		xlsxRow(&b, i+2, row, 0)
+	}
+	b.WriteString(`</sheetData>`)
+	if filter {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, xlsxColumn(len(header)-1), len(rows)+1)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.Bytes()
+}
+
+func xlsxRow(b *bytes.Buffer, n int, cells []interface{}, style int) {
+	fmt.Fprintf(b, `<row r="%d">`, n)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(n)
+		switch v := cell.(type) {
+		case int:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		case float64:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			s := truncate(fmt.Sprint(v), xlsxMaxCell, "")
+			fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			xml.EscapeText(b, []byte(s))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets>` +
+	`<sheet name="Results" sheetId="1" r:id="rId1"/>` +
+	`<sheet name="Summary" sheetId="2" r:id="rId2"/>` +
+	`</sheets>` +
+	`<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">Results!%s</definedName></definedNames>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>` +
+	`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles defines style 0 as the default and style 1 as a bold header.
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"},
+		{1, "B"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+		{16383, "XFD"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.i); got != tt.want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXRange(t *testing.T) {
+	if got, want := xlsxRange(4, 10), "$A$1:$D$10"; got != want {
+		t.Errorf("xlsxRange(4, 10) = %q, want %q", got, want)
+	}
+}